@@ -0,0 +1,63 @@
+package clientPool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// autoEvict 自动移除长期熔断客户端的参数
+type autoEvict struct {
+	deadAfter time.Duration
+	onEvict   func(id string)
+}
+
+// startAutoEvict 启动后台任务，每隔 deadAfter/4 移除连续熔断超过 deadAfter 的客户端，Close 时停止
+func (c *ClientPool[T]) startAutoEvict() {
+	interval := max(c.opts.autoEvict.deadAfter/4, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.evictDead()
+			}
+		}
+	}()
+
+	var once sync.Once
+	c.addBackground(func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	})
+}
+
+// evictDead 移除连续熔断超过 deadAfter 的客户端，并在释放锁后对每个被移除的客户端调用 onEvict
+func (c *ClientPool[T]) evictDead() {
+	deadAfter := c.opts.autoEvict.deadAfter
+	var evicted []string
+	c.mu.Lock()
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		snap := c.clients[i].Snapshot()
+		if snap.Unavailable && !snap.OpenedAt.IsZero() && c.since(snap.OpenedAt) >= deadAfter {
+			evicted = append(evicted, c.clients[i].GetClientId())
+			c.removeLocked(i)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.opts.autoEvict.onEvict == nil {
+		return
+	}
+	for _, id := range evicted {
+		c.opts.autoEvict.onEvict(id)
+	}
+}
@@ -0,0 +1,36 @@
+package clientPool
+
+import "github.com/bighu630/clientPool/clientWrapper"
+
+// BalancerFunc 从 clients 中选出一个客户端，返回其下标；ok 为 false 表示不选择任何客户端
+type BalancerFunc func(clients []ClientView) (index int, ok bool)
+
+// custom 调用 WithBalancerFunc 配置的函数选择客户端，tried 中的客户端不会传给该函数。
+// 函数在池的读锁下调用，不能再调用池的方法；选中不可用的客户端时返回 NoAvailableClientError
+func (c *ClientPool[T]) custom(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	if c.opts.balancerFunc == nil {
+		return nil, ErrNoBalancerFunc
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	candidates := make([]clientWrapper.ClientWrapped[T], 0, len(c.clients))
+	views := make([]ClientView, 0, len(c.clients))
+	for _, cw := range c.clients {
+		if tried[cw] {
+			continue
+		}
+		candidates = append(candidates, cw)
+		views = append(views, c.viewOf(cw))
+	}
+	if len(views) == 0 {
+		return nil, NoAvailableClientError
+	}
+	i, ok := c.opts.balancerFunc(views)
+	if !ok || i < 0 || i >= len(candidates) {
+		return nil, NoAvailableClientError
+	}
+	if cw := candidates[i]; c.eligible(cw) && c.acquire(cw) {
+		return cw, nil
+	}
+	return nil, NoAvailableClientError
+}
@@ -0,0 +1,28 @@
+package clientPool
+
+import (
+	"context"
+	"sync"
+)
+
+// DoBatch 把 items 逐个通过 pool.Do 分发到客户端执行（负载均衡、中间件、熔断与故障转移都照常生效），
+// 最多 concurrency 个同时执行，concurrency <= 0 时为 1。返回与 items 一一对应的错误，成功的位置为 nil。
+// 前面的条目失败导致客户端熔断后，后面的条目自然不再分发给它
+func DoBatch[T, I any](pool *ClientPool[T], ctx context.Context, items []I, fn func(ctx context.Context, client T, item I) error, concurrency int) []error {
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = pool.Do(ctx, func(ctx context.Context, client T) error {
+				return fn(ctx, client, item)
+			})
+		}()
+	}
+	wg.Wait()
+	return errs
+}
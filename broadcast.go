@@ -0,0 +1,71 @@
+package clientPool
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// ClientResult 是 DoAll 在单个客户端上的执行结果
+type ClientResult struct {
+	ID  string
+	Err error
+}
+
+// DoAll 依次在每个可用客户端上执行 fn（如缓存失效、预热），熔断中的客户端被跳过，
+// 冷却结束的客户端按半开规则参与探测。结果按客户端在池中的顺序返回，每次执行同样经过中间件并更新熔断状态。
+// ctx 已取消、池已关闭或 fn 为 nil 时不执行，返回只有一个结果的切片，其 ID 为空、Err 为对应错误
+// （ctx.Err()、ErrPoolClosed 或 ErrNilFunc），以便与“没有可用客户端”（返回空切片）区分
+func (c *ClientPool[T]) DoAll(ctx context.Context, fn func(ctx context.Context, client T) error) []ClientResult {
+	return c.doAll(ctx, false, fn)
+}
+
+// DoAllConcurrent 与 DoAll 相同，但在所有客户端上并发执行 fn，全部结束后返回
+func (c *ClientPool[T]) DoAllConcurrent(ctx context.Context, fn func(ctx context.Context, client T) error) []ClientResult {
+	return c.doAll(ctx, true, fn)
+}
+
+func (c *ClientPool[T]) doAll(ctx context.Context, concurrent bool, fn func(ctx context.Context, client T) error) []ClientResult {
+	if fn == nil {
+		return []ClientResult{{Err: ErrNilFunc}}
+	}
+	if err := ctx.Err(); err != nil {
+		return []ClientResult{{Err: err}}
+	}
+	if err := c.enter(); err != nil {
+		return []ClientResult{{Err: err}}
+	}
+	defer c.leave()
+
+	c.mu.RLock()
+	clients := slices.Clone(c.clients)
+	c.mu.RUnlock()
+
+	selected := make([]clientWrapper.ClientWrapped[T], 0, len(clients))
+	for _, cw := range clients {
+		if c.eligible(cw) && c.acquire(cw) {
+			selected = append(selected, cw)
+		}
+	}
+
+	results := make([]ClientResult, len(selected))
+	var wg sync.WaitGroup
+	for i, cw := range selected {
+		run := func() {
+			results[i] = ClientResult{ID: cw.GetClientId(), Err: c.invoke(ctx, cw, fn)}
+		}
+		if !concurrent {
+			run()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+	wg.Wait()
+	return results
+}
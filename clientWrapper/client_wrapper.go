@@ -2,41 +2,163 @@ package clientWrapper
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// 熔断状态的可读字符串
+const (
+	StateClosed   = "closed"    // 正常
+	StateOpen     = "open"      // 熔断中
+	StateHalfOpen = "half-open" // 冷却结束，正在执行唯一的探测请求
+	StateDraining = "draining"  // 排空中，不接收新请求，优先于熔断状态显示
+)
+
 type ClientWrapped[T any] interface {
 	GetClientId() string
 	ResetAvailable()
+	MarkUnavailable()
 	MarkFail(maxFail int)
+	MarkFailTripped(maxFail int) (tripped bool)
 	MarkSuccess()
+	RecordOutcome(failed bool, window time.Duration) (total, failures int)
+	Trip() (tripped bool)
+	ResetTrips()
 	GetLastFail() time.Time
+	GetCooldown() time.Duration
+	SetCooldown(d time.Duration)
+	BaseCooldown() time.Duration
+	GetLastSuccess() time.Time
 	GetWight() int
 	GetClient() T
+	Build() (T, error)
+	Built() (T, bool)
+	Invalidate()
 	IsUnavailable() bool
+	State() string
+	Snapshot() Snapshot
+	Restore(s Snapshot)
+	CurrentWeight() (current, effective int)
+	AddCurrentWeight() (current, effective int)
+	SubCurrentWeight(total int)
+	TryProbe() bool
+	EndProbe()
+	IsProbing() bool
+	SetDraining(draining bool)
+	IsDraining() bool
+	AddInflight(delta int) int
+	Inflight() int
+}
+
+// Snapshot 是客户端可变状态在某一时刻的拷贝
+type Snapshot struct {
+	FailCount   int
+	LastFail    time.Time
+	LastSuccess time.Time
+	Unavailable bool
+	State       string
+	Cooldown    time.Duration // 本次熔断的冷却时间，0 表示使用池的默认值
+	Trips       int           // 连续熔断次数，用于退避
+	Successes   int           // 连续成功次数
+	Draining    bool          // 是否正在排空，排空中的客户端不接收新请求，与熔断无关
+	OpenedAt    time.Time     // 本次从关闭进入熔断的时间，未熔断时为零值
+	Probing     bool          // 是否正在执行半开探测
 }
 
 type clientWrapped[T any] struct {
-	// 不可变字段，初始化后不再改变，无需加锁
-	id     string
-	client T   // 客户端
-	weight int // 权重
+	// 不可变字段，初始化后不再改变，无需加锁（延迟创建的客户端除外）
+	id               string
+	client           T                 // 客户端，延迟创建时由 buildMu 保护
+	weight           int               // 权重
+	baseCooldown     time.Duration     // 该客户端的熔断冷却时间，0 表示使用池的 cooldown
+	factory          func() (T, error) // 延迟创建客户端的工厂函数，nil 表示客户端在创建包装时已给出
+	clock            Clock             // 读取当前时间
+	successThreshold int               // 关闭熔断需要的连续成功次数
+
+	// 延迟创建的客户端状态
+	buildMu sync.Mutex
+	built   bool
 
 	// 可变字段，需要加锁保护
 	mu          sync.Mutex
-	failCount   int       // 连续失败次数
-	lastFail    time.Time // 最后一次失败时间
-	unavailable bool      // 是否可用
+	failCount   int           // 连续失败次数
+	lastFail    time.Time     // 最后一次失败时间
+	lastSuccess time.Time     // 最后一次成功时间
+	unavailable bool          // 是否可用
+	openedAt    time.Time     // 本次从关闭进入熔断的时间，半开探测失败不会刷新，关闭后清零
+	cooldown    time.Duration // 熔断时由池计算的冷却时间，0 表示使用池的默认值
+	trips       int           // 连续熔断次数，持续成功后由池重置
+	successes   int           // 连续成功次数
+	outcomes    outcomeWindow // 最近一个窗口内的请求结果，用于按错误率熔断
+
+	// 半开状态下是否有探测请求在执行，同一时刻只允许一个
+	probing atomic.Bool
+	// 是否正在排空，由调用方控制，不影响熔断状态
+	draining atomic.Bool
+	// 正在该客户端上执行的请求数
+	inflight atomic.Int64
+
+	// 平滑加权轮询状态，由负载均衡器在池锁下更新
+	currentWeight   int
+	effectiveWeight int
+}
+
+// Option 配置客户端包装的不可变属性
+type Option func(*config)
+
+type config struct {
+	cooldown         time.Duration
+	clock            Clock
+	successThreshold int
+}
+
+// WithCooldown 为该客户端单独指定熔断冷却时间，覆盖池的 cooldown
+func WithCooldown(d time.Duration) Option {
+	return func(c *config) {
+		c.cooldown = d
+	}
+}
+
+// WithSuccessThreshold 设置熔断中的客户端需要连续成功多少次才关闭熔断，默认（小于 1 时）为 1
+func WithSuccessThreshold(n int) Option {
+	return func(c *config) {
+		c.successThreshold = n
+	}
+}
+
+// WithClock 指定读取当前时间的时钟，默认 RealClock，nil 被忽略
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
 }
 
-func NewClientWrapper[T any](client T, id string, weight int) ClientWrapped[T] {
+func NewClientWrapper[T any](client T, id string, weight int, opts ...Option) ClientWrapped[T] {
+	cfg := config{clock: RealClock()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	return &clientWrapped[T]{
-		id:     id,
-		client: client,
-		weight: weight,
+		id:               id,
+		client:           client,
+		weight:           weight,
+		baseCooldown:     cfg.cooldown,
+		clock:            cfg.clock,
+		successThreshold: max(cfg.successThreshold, 1),
+		effectiveWeight:  weight,
 	}
 }
 
+// NewLazyClientWrapper 创建延迟创建客户端的包装，客户端在第一次 Build 时由 factory 创建
+func NewLazyClientWrapper[T any](id string, weight int, factory func() (T, error), opts ...Option) ClientWrapped[T] {
+	var zero T
+	w := NewClientWrapper(zero, id, weight, opts...).(*clientWrapped[T])
+	w.factory = factory
+	return w
+}
+
 // GetClientId 返回客户端ID（不可变字段，无需加锁）
 func (c *clientWrapped[T]) GetClientId() string {
 	return c.id
@@ -47,26 +169,105 @@ func (c *clientWrapped[T]) ResetAvailable() {
 	defer c.mu.Unlock()
 	c.failCount = 0
 	c.unavailable = false
+	c.openedAt = time.Time{}
+	c.probing.Store(false)
 }
 
+// MarkUnavailable 直接把客户端置为熔断状态并从现在开始计算冷却时间，
+// 用于添加已知不可用的客户端
+func (c *clientWrapped[T]) MarkUnavailable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failCount = max(c.failCount, 1)
+	c.unavailable = true
+	c.lastFail = c.clock.Now()
+	c.markOpenedLocked()
+	c.probing.Store(false)
+}
+
+// MarkFail 记录一次失败，同时结束半开探测（探测失败即重新熔断）
 func (c *clientWrapped[T]) MarkFail(maxFail int) {
+	c.MarkFailTripped(maxFail)
+}
+
+// MarkFailTripped 与 MarkFail 相同，并在本次失败让客户端进入熔断（从关闭或半开状态）时返回 true
+func (c *clientWrapped[T]) MarkFailTripped(maxFail int) (tripped bool) {
 	if maxFail == 0 {
-		return
+		return false
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	wasOpen := c.unavailable && c.failCount > 0 && !c.probing.Load()
 	c.failCount++
 	if c.failCount >= maxFail {
 		c.unavailable = true
 	}
-	c.lastFail = time.Now()
+	tripped = c.unavailable && !wasOpen
+	if tripped {
+		c.trips++
+		c.outcomes.reset()
+	}
+	c.successes = 0
+	c.lastFail = c.clock.Now()
+	if c.unavailable {
+		c.markOpenedLocked()
+	}
+	c.probing.Store(false)
+	// 失败时降低有效权重，之后每次被选中逐步恢复
+	c.effectiveWeight -= max(c.weight/maxFail, 1)
+	if c.effectiveWeight < 0 {
+		c.effectiveWeight = 0
+	}
+	return tripped
 }
 
+// MarkSuccess 记录一次成功并结束半开探测。熔断中的客户端需要连续成功 WithSuccessThreshold 次
+// （默认 1 次）才关闭熔断，未达到时保持熔断但允许下一次探测
 func (c *clientWrapped[T]) MarkSuccess() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.lastSuccess = c.clock.Now()
+	c.successes++
+	c.probing.Store(false)
+	if c.unavailable && c.failCount > 0 && c.successes < c.successThreshold {
+		return
+	}
 	c.failCount = 0
 	c.unavailable = false
+	c.openedAt = time.Time{}
+}
+
+// RecordOutcome 把一次请求结果记入滑动窗口，返回 window 内的请求数与失败数
+func (c *clientWrapped[T]) RecordOutcome(failed bool, window time.Duration) (total, failures int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outcomes.record(c.clock.Now(), window, failed)
+}
+
+// Trip 不论失败次数直接熔断并开始冷却，同时清空结果窗口，用于按错误率熔断。
+// 已经处于熔断（非半开）状态时不做任何事并返回 false
+func (c *clientWrapped[T]) Trip() (tripped bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unavailable && c.failCount > 0 && !c.probing.Load() {
+		return false
+	}
+	c.failCount = max(c.failCount, 1)
+	c.unavailable = true
+	c.trips++
+	c.successes = 0
+	c.lastFail = c.clock.Now()
+	c.markOpenedLocked()
+	c.probing.Store(false)
+	c.outcomes.reset()
+	return true
+}
+
+// ResetTrips 清零连续熔断次数，退避从头开始
+func (c *clientWrapped[T]) ResetTrips() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trips = 0
 }
 
 func (c *clientWrapped[T]) GetLastFail() time.Time {
@@ -75,9 +276,76 @@ func (c *clientWrapped[T]) GetLastFail() time.Time {
 	return c.lastFail
 }
 
-// GetClient 返回客户端实例（不可变字段，无需加锁）
+func (c *clientWrapped[T]) GetLastSuccess() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSuccess
+}
+
+// GetCooldown 返回本次熔断的冷却时间，0 表示使用池的默认值
+func (c *clientWrapped[T]) GetCooldown() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cooldown
+}
+
+// BaseCooldown 返回创建时为该客户端指定的冷却时间（不可变字段，无需加锁），0 表示使用池的 cooldown
+func (c *clientWrapped[T]) BaseCooldown() time.Duration {
+	return c.baseCooldown
+}
+
+// SetCooldown 设置本次熔断的冷却时间，由池在熔断发生时计算（如加入随机抖动）
+func (c *clientWrapped[T]) SetCooldown(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cooldown = d
+}
+
+// GetClient 返回客户端实例，延迟创建的客户端尚未创建时返回零值
 func (c *clientWrapped[T]) GetClient() T {
-	return c.client
+	client, _ := c.Built()
+	return client
+}
+
+// Build 返回客户端实例，延迟创建的客户端在第一次调用（或 Invalidate 之后）时调用工厂函数创建，
+// 工厂函数返回错误时不缓存结果，下次调用重新创建
+func (c *clientWrapped[T]) Build() (T, error) {
+	if c.factory == nil {
+		return c.client, nil
+	}
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+	if !c.built {
+		client, err := c.factory()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		c.client, c.built = client, true
+	}
+	return c.client, nil
+}
+
+// Built 返回已创建的客户端实例及其是否存在，不会触发创建
+func (c *clientWrapped[T]) Built() (T, bool) {
+	if c.factory == nil {
+		return c.client, true
+	}
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+	return c.client, c.built
+}
+
+// Invalidate 丢弃延迟创建的客户端，下次 Build 时重新调用工厂函数；旧实例不会被关闭，
+// 进行中的请求可以继续使用。非延迟创建的客户端不受影响
+func (c *clientWrapped[T]) Invalidate() {
+	if c.factory == nil {
+		return
+	}
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+	var zero T
+	c.client, c.built = zero, false
 }
 
 // GetWight 返回权重（不可变字段，无需加锁）
@@ -90,3 +358,136 @@ func (c *clientWrapped[T]) IsUnavailable() bool {
 	defer c.mu.Unlock()
 	return c.unavailable && c.failCount > 0
 }
+
+// State 返回客户端状态的可读字符串（closed、open、half-open，排空中为 draining），用于日志与状态展示
+func (c *clientWrapped[T]) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stateLocked()
+}
+
+// Snapshot 在同一把锁下读取所有可变字段，保证各字段彼此一致
+func (c *clientWrapped[T]) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Snapshot{
+		FailCount:   c.failCount,
+		LastFail:    c.lastFail,
+		LastSuccess: c.lastSuccess,
+		Unavailable: c.unavailable && c.failCount > 0,
+		State:       c.stateLocked(),
+		Cooldown:    c.cooldown,
+		Trips:       c.trips,
+		Successes:   c.successes,
+		Draining:    c.draining.Load(),
+		OpenedAt:    c.openedAt,
+		Probing:     c.probing.Load(),
+	}
+}
+
+// Restore 用快照覆盖熔断相关状态（失败次数、最后成功/失败时间、是否熔断、冷却与退避）及排空标记，
+// 用于替换客户端时保留旧客户端的熔断状态；快照中的 State 由其他字段推导，会被忽略
+func (c *clientWrapped[T]) Restore(s Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failCount = s.FailCount
+	c.lastFail = s.LastFail
+	c.lastSuccess = s.LastSuccess
+	c.unavailable = s.Unavailable
+	c.openedAt = time.Time{}
+	if s.Unavailable {
+		// 快照没有 OpenedAt 时（如从 WrapperState 导入）按最后失败时间估计
+		c.openedAt = s.OpenedAt
+		if c.openedAt.IsZero() {
+			c.openedAt = s.LastFail
+		}
+	}
+	c.cooldown = s.Cooldown
+	c.trips = s.Trips
+	c.successes = s.Successes
+	c.probing.Store(false)
+	c.draining.Store(s.Draining)
+}
+
+// markOpenedLocked 在客户端从关闭进入熔断时记录时间，已在熔断中时保持不变，调用方需持有锁
+func (c *clientWrapped[T]) markOpenedLocked() {
+	if c.openedAt.IsZero() {
+		c.openedAt = c.lastFail
+	}
+}
+
+// stateLocked 计算熔断状态，调用方需持有锁
+func (c *clientWrapped[T]) stateLocked() string {
+	if c.draining.Load() {
+		return StateDraining
+	}
+	if c.unavailable && c.failCount > 0 {
+		if c.probing.Load() {
+			return StateHalfOpen
+		}
+		return StateOpen
+	}
+	return StateClosed
+}
+
+// TryProbe 尝试占用半开探测名额，同一时刻只有一个调用者能成功
+func (c *clientWrapped[T]) TryProbe() bool {
+	return c.probing.CompareAndSwap(false, true)
+}
+
+// EndProbe 在不改变熔断状态的情况下释放探测名额（如中间件自身报错）
+func (c *clientWrapped[T]) EndProbe() {
+	c.probing.Store(false)
+}
+
+// IsProbing 是否有探测请求在执行
+func (c *clientWrapped[T]) IsProbing() bool {
+	return c.probing.Load()
+}
+
+// CurrentWeight 返回当前权重与有效权重，不修改状态
+func (c *clientWrapped[T]) CurrentWeight() (current, effective int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentWeight, c.effectiveWeight
+}
+
+// AddCurrentWeight 把有效权重累加到当前权重，并让有效权重向配置权重恢复 1，
+// 返回累加后的当前权重与累加时使用的有效权重
+func (c *clientWrapped[T]) AddCurrentWeight() (current, effective int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	effective = c.effectiveWeight
+	c.currentWeight += effective
+	if c.effectiveWeight < c.weight {
+		c.effectiveWeight++
+	}
+	return c.currentWeight, effective
+}
+
+// SubCurrentWeight 被选中后从当前权重中扣除本轮总权重
+func (c *clientWrapped[T]) SubCurrentWeight(total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.currentWeight -= total
+}
+
+// SetDraining 设置排空标记
+func (c *clientWrapped[T]) SetDraining(draining bool) {
+	c.draining.Store(draining)
+}
+
+// IsDraining 返回客户端是否正在排空
+func (c *clientWrapped[T]) IsDraining() bool {
+	return c.draining.Load()
+}
+
+// AddInflight 调整正在执行的请求数，返回调整后的值
+func (c *clientWrapped[T]) AddInflight(delta int) int {
+	return int(c.inflight.Add(int64(delta)))
+}
+
+// Inflight 返回正在该客户端上执行的请求数
+func (c *clientWrapped[T]) Inflight() int {
+	return int(c.inflight.Load())
+}
@@ -0,0 +1,17 @@
+package clientWrapper
+
+import "time"
+
+// Clock 提供当前时间，熔断的失败时间、冷却判断等都通过它读取，测试中可替换为手动推进的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// RealClock 返回使用 time.Now 的默认时钟
+func RealClock() Clock {
+	return realClock{}
+}
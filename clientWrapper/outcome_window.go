@@ -0,0 +1,43 @@
+package clientWrapper
+
+import "time"
+
+// outcomeBuckets 是滑动窗口划分的桶数，窗口按桶的粒度向前滑动
+const outcomeBuckets = 10
+
+// outcomeWindow 按时间分桶的环形缓冲区，统计最近一个窗口内的请求数与失败数
+type outcomeWindow struct {
+	buckets [outcomeBuckets]outcomeBucket
+}
+
+type outcomeBucket struct {
+	epoch    int64 // 桶对应的时间片序号，用于判断桶是否过期
+	total    int
+	failures int
+}
+
+// record 记录一次结果，返回包含本次在内 window 内的请求数与失败数
+func (w *outcomeWindow) record(now time.Time, window time.Duration, failed bool) (total, failures int) {
+	width := max(int64(window)/outcomeBuckets, 1)
+	epoch := now.UnixNano() / width
+	b := &w.buckets[epoch%outcomeBuckets]
+	if b.epoch != epoch {
+		*b = outcomeBucket{epoch: epoch}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+	for i := range w.buckets {
+		if b := w.buckets[i]; b.epoch > epoch-outcomeBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+// reset 清空窗口
+func (w *outcomeWindow) reset() {
+	w.buckets = [outcomeBuckets]outcomeBucket{}
+}
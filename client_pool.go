@@ -3,9 +3,12 @@ package clientPool
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bighu630/clientPool/clientWrapper"
@@ -14,34 +17,130 @@ import (
 
 var NoAvailableClientError = errors.New("no available client")
 
+// ErrPoolClosed 表示池已关闭
+var ErrPoolClosed = errors.New("client pool closed")
+
+// ErrDuplicateClientID 表示池中已存在相同 id 的客户端
+var ErrDuplicateClientID = errors.New("duplicate client id")
+
+// ErrNilFunc 表示传给 Do 系列方法的业务函数为 nil，此时不会选择客户端
+var ErrNilFunc = errors.New("nil business function")
+
+// errClientTripped 表示选中的客户端在执行 fn 前被其他请求熔断，池会换一个客户端重新执行
+var errClientTripped = errors.New("client tripped before invoke")
+
+// ErrNoBalancerFunc 表示使用 CustomBalancer 但没有通过 WithBalancerFunc 配置选择函数
+var ErrNoBalancerFunc = errors.New("custom balancer function not configured")
+
+// ClientsUnavailableError 描述选不到客户端时池的状态，用于区分池为空与全部熔断。
+// errors.Is(err, NoAvailableClientError) 仍然成立
+type ClientsUnavailableError struct {
+	TotalClients   int      // 池中的客户端总数
+	UnavailableIDs []string // 熔断中的客户端
+	DrainingIDs    []string // 排空中的客户端
+}
+
+func (e *ClientsUnavailableError) Error() string {
+	if e.TotalClients == 0 {
+		return fmt.Sprintf("%v: pool is empty", NoAvailableClientError)
+	}
+	return fmt.Sprintf("%v: %d clients, unavailable %v, draining %v", NoAvailableClientError, e.TotalClients, e.UnavailableIDs, e.DrainingIDs)
+}
+
+func (e *ClientsUnavailableError) Unwrap() error {
+	return NoAvailableClientError
+}
+
+// unavailableError 在 err 为 NoAvailableClientError 时附加池的当前状态，其他错误原样返回
+func (c *ClientPool[T]) unavailableError(err error) error {
+	if err != NoAvailableClientError {
+		return err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	detail := &ClientsUnavailableError{TotalClients: len(c.clients)}
+	for _, cw := range c.clients {
+		if cw.IsDraining() {
+			detail.DrainingIDs = append(detail.DrainingIDs, cw.GetClientId())
+		} else if cw.IsUnavailable() {
+			detail.UnavailableIDs = append(detail.UnavailableIDs, cw.GetClientId())
+		}
+	}
+	return detail
+}
+
 type BalancerType string
 
 const (
 	RoundRobin     BalancerType = "round_robin"
 	WeightedRandom BalancerType = "weighted_random"
 	Random         BalancerType = "random"
+	// SmoothWeightedRoundRobin 平滑加权轮询（nginx 算法），按权重均匀交错地选择
+	SmoothWeightedRoundRobin BalancerType = "smooth_weighted_round_robin"
+	// ConsistentHash 一致性哈希，配合 DoHashedClient 让相同 key 落到同一客户端
+	ConsistentHash BalancerType = "consistent_hash"
+	// WeightedLeastConnections 加权最少连接，选择 正在执行的请求数/权重 最小的客户端
+	WeightedLeastConnections BalancerType = "weighted_least_connections"
+	// CustomBalancer 使用 WithBalancerFunc 配置的函数选择客户端
+	CustomBalancer BalancerType = "custom"
 )
 
+// valid 判断是否为内置的负载均衡策略
+func (b BalancerType) valid() bool {
+	switch b {
+	case RoundRobin, WeightedRandom, Random, SmoothWeightedRoundRobin, ConsistentHash, WeightedLeastConnections, CustomBalancer:
+		return true
+	}
+	return false
+}
+
 type ClientPool[T any] struct {
 	mu              sync.RWMutex
 	clients         []clientWrapper.ClientWrapped[T]
-	index           int
+	index           atomic.Uint64 // 轮询位置
 	rand            *rand.Rand
+	randMu          sync.Mutex    // *rand.Rand 不是并发安全的，所有使用都需持有该锁
 	maxFails        int           // 最大失败次数
 	cooldown        time.Duration // 熔断恢复时间
 	defaultBalancer BalancerType
 	middlewares     []middleware.Middleware[T]
+	ringMu          sync.Mutex    // 保护 ring 与 ringDirty，持有读锁的选择过程也可能重建哈希环
+	ring            []hashNode[T] // 一致性哈希环，客户端变化后在下一次一致性哈希选择时重建
+	ringDirty       bool
+	opts            options
+
+	// 生命周期，由 lifeMu 保护
+	lifeMu   sync.Mutex
+	idle     chan struct{} // 关闭后等待进行中的请求时创建，inflight 归零时关闭
+	closed   bool          // 拒绝新的请求
+	shutdown bool          // 后台任务与客户端已关闭
+	inflight int           // 正在执行的请求数
+	stops    []func()      // 后台任务的停止函数
 }
 
-func NewClientPool[T any](maxFails int, cooldown time.Duration, defaultBalancer BalancerType) *ClientPool[T] {
+func NewClientPool[T any](maxFails int, cooldown time.Duration, defaultBalancer BalancerType, opts ...Option) *ClientPool[T] {
 	c := &ClientPool[T]{
-		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
 		maxFails:        maxFails,
 		cooldown:        cooldown,
 		defaultBalancer: defaultBalancer,
 		middlewares:     make([]middleware.Middleware[T], 0),
+		opts:            defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	seed := time.Now().UnixNano()
+	if c.opts.seeded {
+		seed = c.opts.seed
+	}
+	c.rand = rand.New(rand.NewSource(seed))
+	if c.opts.metrics {
+		registerMetrics()
+	}
+	c.RegisterMiddleware(middleware.NewRecoverMiddleware[T](middleware.WithPanicHandler(c.opts.panicHandler)))
+	if c.opts.autoEvict.deadAfter > 0 {
+		c.startAutoEvict()
 	}
-	c.RegisterMiddleware(middleware.RecoverMiddleware[T]())
 	return c
 }
 
@@ -53,98 +152,652 @@ func (c *ClientPool[T]) GetClientPool() []clientWrapper.ClientWrapped[T] {
 
 // 添加client, if weight <= 0, weight = 1
 func (c *ClientPool[T]) AddClient(client T, id string, weight int) {
+	c.AddClientWithState(client, id, weight, true)
+}
+
+// AddClientWithState 添加客户端并指定初始可用状态。available 为 false 时客户端以熔断状态加入，
+// 冷却结束（或健康检查探测成功）之前不会被选中
+func (c *ClientPool[T]) AddClientWithState(client T, id string, weight int, available bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addClientLocked(ClientSpec[T]{Client: client, ID: id, Weight: weight}, available)
+}
+
+// AddClientWithConfig 按 spec 添加客户端，可以为该客户端单独指定熔断冷却时间
+func (c *ClientPool[T]) AddClientWithConfig(spec ClientSpec[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addClientLocked(spec, true)
+}
+
+// AddLazyClient 添加延迟创建的客户端：第一次被选中时才调用 factory 创建，熔断后丢弃实例，
+// 恢复后再次被选中时重新创建。factory 返回错误时本次请求失败并计入熔断
+func (c *ClientPool[T]) AddLazyClient(id string, weight int, factory func() (T, error)) {
+	c.AddClientWithConfig(ClientSpec[T]{ID: id, Weight: weight, Factory: factory})
+}
+
+// AddClientWithEviction 与 AddClient 相同，池已达到 WithMaxClients 上限时先淘汰最差的客户端，
+// 返回被淘汰的客户端ID；未发生淘汰时 evicted 为 false
+func (c *ClientPool[T]) AddClientWithEviction(client T, id string, weight int) (evictedID string, evicted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addClientLocked(ClientSpec[T]{Client: client, ID: id, Weight: weight}, true)
+}
+
+// AddClientChecked 与 AddClient 相同，但 id 已存在时返回 ErrDuplicateClientID 且不修改池。
+// AddClient 不做检查，配置热加载等需要保证 id 唯一的场景应使用本方法
+func (c *ClientPool[T]) AddClientChecked(client T, id string, weight int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.indexOfLocked(id) >= 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateClientID, id)
+	}
+	c.addClientLocked(ClientSpec[T]{Client: client, ID: id, Weight: weight}, true)
+	return nil
+}
+
+// ClientSpec 描述 AddClientWithConfig 与 ReplaceClients 中的一个客户端
+type ClientSpec[T any] struct {
+	Client   T
+	ID       string
+	Weight   int           // <= 0 时为 1
+	Cooldown time.Duration // 该客户端的熔断冷却时间，0 时使用池的 cooldown；启用 WithBackoff 时不生效
+	// Factory 非空时客户端延迟创建，忽略 Client，见 AddLazyClient
+	Factory func() (T, error)
+}
+
+// ReplaceClients 在一次写锁内用 specs 原子地替换池中所有客户端，并重置轮询位置，
+// 不会出现池被部分填充的中间状态。keepState 为 true 时，替换前后都存在的 id 保留原有熔断状态。
+// specs 中有重复 id 时返回 ErrDuplicateClientID 且不修改池。被移除的客户端不会被关闭，
+// 进行中的请求会在旧客户端上正常完成
+func (c *ClientPool[T]) ReplaceClients(specs []ClientSpec[T], keepState bool) error {
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if seen[spec.ID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateClientID, spec.ID)
+		}
+		seen[spec.ID] = true
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if weight <= 0 {
-		weight = 1
+	old := make(map[string]clientWrapper.ClientWrapped[T], len(c.clients))
+	for _, cw := range c.clients {
+		old[cw.GetClientId()] = cw
+	}
+	// 新建切片而不是原地修改，持有旧切片的调用者不受影响
+	clients := make([]clientWrapper.ClientWrapped[T], 0, len(specs))
+	for _, spec := range specs {
+		cw := c.newWrapper(spec)
+		if prev, ok := old[spec.ID]; ok && keepState {
+			cw.Restore(prev.Snapshot())
+		}
+		clients = append(clients, cw)
+	}
+	for id, cw := range old {
+		if !seen[id] {
+			c.forgetState(cw)
+		}
+	}
+	c.clients = clients
+	c.index.Store(0)
+	c.invalidateRing()
+	for _, cw := range clients {
+		c.observeState(cw)
+	}
+	return nil
+}
+
+// RemoveClient 移除 id 对应的客户端，不存在时返回 false。被移除的客户端不会被关闭，
+// 进行中的请求会在它上面正常完成
+func (c *ClientPool[T]) RemoveClient(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.indexOfLocked(id)
+	if i < 0 {
+		return false
+	}
+	c.removeLocked(i)
+	return true
+}
+
+// removeLocked 移除下标 i 处的客户端，调用方需持有写锁
+func (c *ClientPool[T]) removeLocked(i int) {
+	c.forgetState(c.clients[i])
+	// 新建切片而不是原地修改，持有旧切片的调用者不受影响
+	c.clients = slices.Delete(slices.Clone(c.clients), i, i+1)
+	c.invalidateRing()
+}
+
+// Len 返回池中的客户端数量
+func (c *ClientPool[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.clients)
+}
+
+// IDs 按加入顺序返回池中所有客户端ID的拷贝
+func (c *ClientPool[T]) IDs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids := make([]string, 0, len(c.clients))
+	for _, cw := range c.clients {
+		ids = append(ids, cw.GetClientId())
+	}
+	return ids
+}
+
+// AvailableCount 返回当前可被选中的客户端数量（未熔断或冷却已结束，且未在排空），
+// 与负载均衡器使用相同的判断，但不修改状态，不会触发半开探测
+func (c *ClientPool[T]) AvailableCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n := 0
+	for _, cw := range c.clients {
+		if c.eligible(cw) {
+			n++
+		}
+	}
+	return n
+}
+
+// Healthy 至少有一个客户端可被选中时返回 nil，否则返回 *ClientsUnavailableError，
+// 其中列出熔断中与排空中的客户端，适合用于 /healthz
+func (c *ClientPool[T]) Healthy() error {
+	if c.AvailableCount() > 0 {
+		return nil
+	}
+	return c.unavailableError(NoAvailableClientError)
+}
+
+// GetClient 返回 id 对应的底层客户端实例，不存在时第二个返回值为 false。
+// 直接使用返回的客户端不经过中间件，也不参与熔断统计；延迟创建且尚未创建的客户端返回零值
+func (c *ClientPool[T]) GetClient(id string) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.indexOfLocked(id)
+	if i < 0 {
+		var zero T
+		return zero, false
+	}
+	return c.clients[i].GetClient(), true
+}
+
+// DrainClient 让客户端停止接收新请求（已在执行的请求不受影响），不计为失败，
+// 用于上游维护；客户端不存在时返回 false
+func (c *ClientPool[T]) DrainClient(id string) bool {
+	return c.setDraining(id, true)
+}
+
+// UndrainClient 恢复排空中的客户端，客户端不存在时返回 false
+func (c *ClientPool[T]) UndrainClient(id string) bool {
+	return c.setDraining(id, false)
+}
+
+func (c *ClientPool[T]) setDraining(id string, draining bool) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.indexOfLocked(id)
+	if i < 0 {
+		return false
+	}
+	c.clients[i].SetDraining(draining)
+	return true
+}
+
+// indexOfLocked 返回 id 对应客户端的下标，不存在时返回 -1，调用方需持有锁
+func (c *ClientPool[T]) indexOfLocked(id string) int {
+	return slices.IndexFunc(c.clients, func(cw clientWrapper.ClientWrapped[T]) bool {
+		return cw.GetClientId() == id
+	})
+}
+
+// newWrapper 按 spec 创建客户端包装，weight <= 0 时为 1
+func (c *ClientPool[T]) newWrapper(spec ClientSpec[T]) clientWrapper.ClientWrapped[T] {
+	opts := []clientWrapper.Option{
+		clientWrapper.WithCooldown(spec.Cooldown),
+		clientWrapper.WithClock(c.opts.clock),
+		clientWrapper.WithSuccessThreshold(c.opts.successThreshold),
+	}
+	if spec.Factory != nil {
+		return clientWrapper.NewLazyClientWrapper(spec.ID, max(spec.Weight, 1), spec.Factory, opts...)
+	}
+	return clientWrapper.NewClientWrapper(spec.Client, spec.ID, max(spec.Weight, 1), opts...)
+}
+
+// addClientLocked 添加客户端，达到 WithMaxClients 上限时先淘汰最差的客户端并返回其ID，调用方需持有写锁
+func (c *ClientPool[T]) addClientLocked(spec ClientSpec[T], available bool) (evictedID string, evicted bool) {
+	if limit := c.opts.maxClients; limit > 0 && len(c.clients) >= limit {
+		i := c.worstLocked()
+		evictedID, evicted = c.clients[i].GetClientId(), true
+		c.removeLocked(i)
+	}
+	cw := c.newWrapper(spec)
+	if !available {
+		cw.MarkUnavailable()
+		cw.SetCooldown(c.tripCooldown(cw))
 	}
-	c.clients = append(c.clients, clientWrapper.NewClientWrapper(client, id, weight))
+	c.clients = append(c.clients, cw)
+	c.invalidateRing()
+	c.observeState(cw)
+	return evictedID, evicted
 }
 
-// middleware需要有序添加
+// worstLocked 返回淘汰时选择的客户端下标：连续失败次数最多的，相同时选最久没有成功过的，
+// 再相同时选最早加入的。调用方需持有锁且池不为空
+func (c *ClientPool[T]) worstLocked() int {
+	worst := 0
+	worstSnap := c.clients[0].Snapshot()
+	for i, cw := range c.clients[1:] {
+		snap := cw.Snapshot()
+		if snap.FailCount > worstSnap.FailCount ||
+			snap.FailCount == worstSnap.FailCount && snap.LastSuccess.Before(worstSnap.LastSuccess) {
+			worst, worstSnap = i+1, snap
+		}
+	}
+	return worst
+}
+
+// middleware需要有序添加：index 0 在最外层，越晚注册越靠近业务函数。
+// 构造函数默认在 index 0 注册了 RecoverMiddleware，因此追加的中间件都在 recover 内层
 func (c *ClientPool[T]) RegisterMiddleware(middleware middleware.Middleware[T]) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.middlewares = append(c.middlewares, middleware)
 }
 
+// RegisterMiddlewareAt 把中间件插入到 index 位置（0 为最外层），index 越界时截断到首尾。
+// 例如插入到 0 可以让监控中间件包住 RecoverMiddleware，从而把 panic 计为错误
+func (c *ClientPool[T]) RegisterMiddlewareAt(index int, m middleware.Middleware[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index = min(max(index, 0), len(c.middlewares))
+	// 复制后插入，避免改动正在执行的请求持有的切片
+	c.middlewares = slices.Insert(slices.Clone(c.middlewares), index, m)
+}
+
+// RegisterMiddlewareFor 与 RegisterMiddleware 相同，但 m 只在选中客户端的 ID 属于 ids 时执行，
+// 其他客户端直接跳过 m 调用下一层。适合只给个别不稳定的上游加重试等场景
+func (c *ClientPool[T]) RegisterMiddlewareFor(ids []string, m middleware.Middleware[T]) {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	c.RegisterMiddleware(middleware.WrapMiddleware(func(ctx context.Context, client clientWrapper.ClientWrapped[T], next func(ctx context.Context, client clientWrapper.ClientWrapped[T]) error) error {
+		if !set[client.GetClientId()] {
+			return next(ctx, client)
+		}
+		return m.Execute(ctx, client, next)
+	}))
+}
+
+// executeWithMiddleware 把选中客户端的ID放入 context，然后依次执行中间件链与 fn。
+// 启用 WithRecheckBeforeInvoke 时，客户端在执行 fn 前已被熔断则返回 errClientTripped
 func (c *ClientPool[T]) executeWithMiddleware(ctx context.Context, client clientWrapper.ClientWrapped[T], fn func(ctx context.Context, client T) error) error {
 	handler := func(ctx context.Context, client clientWrapper.ClientWrapped[T]) error {
-		return fn(ctx, client.GetClient())
+		// 半开探测中的客户端同样是不可用状态，但它正是被选中来探测的
+		if c.opts.recheck && client.IsUnavailable() && !client.IsProbing() {
+			return middleware.NewMiddlewareError("recheck", errClientTripped)
+		}
+		cl, err := client.Build()
+		if err != nil {
+			return fmt.Errorf("build client %s: %w", client.GetClientId(), err)
+		}
+		return fn(ctx, cl)
 	}
-	for i := len(c.middlewares) - 1; i >= 0; i-- {
+	c.mu.RLock()
+	middlewares := c.middlewares
+	c.mu.RUnlock()
+	for i := len(middlewares) - 1; i >= 0; i-- {
 		next := handler
-		m := c.middlewares[i]
+		m := middlewares[i]
 		handler = func(ctx context.Context, client clientWrapper.ClientWrapped[T]) error {
 			return m.Execute(ctx, client, next)
 		}
 	}
-	return handler(ctx, client)
+	return handler(middleware.WithClientID(ctx, client.GetClientId()), client)
 }
 
 func (c *ClientPool[T]) Do(ctx context.Context, fn func(ctx context.Context, client T) error) error {
-	switch c.defaultBalancer {
-	case RoundRobin:
-		return c.DoRoundRobinClient(ctx, fn)
-	case WeightedRandom:
-		return c.DoWeightedRandomClient(ctx, fn)
-	default:
-		return c.DoRandomClient(ctx, fn)
+	_, err := c.do(ctx, c.defaultBalancer, fn)
+	return err
+}
+
+// DoWithClient 与 Do 相同，同时返回实际执行请求的客户端ID（故障转移时为最后一个尝试的客户端）。
+// fn 失败时也会返回ID，只有没有可用客户端时返回空字符串
+func (c *ClientPool[T]) DoWithClient(ctx context.Context, fn func(ctx context.Context, client T) error) (string, error) {
+	return c.do(ctx, c.defaultBalancer, fn)
+}
+
+// DoWith 与 Do 相同，但本次调用使用 balancer 选择客户端而不是池的默认策略，
+// 无需为个别请求再创建一个池。balancer 不是已知策略时使用默认策略；
+// 使用 ConsistentHash 时通过 WithHashKey 在 ctx 中放入 key
+func (c *ClientPool[T]) DoWith(ctx context.Context, balancer BalancerType, fn func(ctx context.Context, client T) error) error {
+	if !balancer.valid() {
+		balancer = c.defaultBalancer
 	}
+	_, err := c.do(ctx, balancer, fn)
+	return err
+}
+
+// DoMethod 与 Do 相同，但先把 method 作为方法名放入 context（middleware.PrometheusMethodKey），
+// 供 Prometheus、按方法限流等中间件使用，手写代码无需自己注入
+func (c *ClientPool[T]) DoMethod(ctx context.Context, method string, fn func(ctx context.Context, client T) error) error {
+	return c.Do(context.WithValue(ctx, middleware.PrometheusMethodKey{}, method), fn)
+}
+
+// DoWithRetry 与 Do 相同，但本次调用最多尝试 attempts 个客户端（覆盖 WithFailover）：
+// 每次失败后通过负载均衡器重新选择，跳过本次调用中已失败的客户端，而不是在同一客户端上重试。
+// 全部失败时返回最后一个错误；中间件错误与请求取消不重试
+func (c *ClientPool[T]) DoWithRetry(ctx context.Context, attempts int, fn func(ctx context.Context, client T) error) error {
+	_, err := c.doAttempts(ctx, c.defaultBalancer, max(attempts, 1), fn)
+	return err
 }
 
-func (c *ClientPool[T]) doWithClient(ctx context.Context, cw clientWrapper.ClientWrapped[T], fn func(ctx context.Context, client T) error) error {
+// do 按指定负载均衡策略选择客户端执行 fn，启用故障转移时失败后换下一个客户端重试，
+// 返回最后一个执行请求的客户端ID
+func (c *ClientPool[T]) do(ctx context.Context, balancer BalancerType, fn func(ctx context.Context, client T) error) (string, error) {
+	return c.doAttempts(ctx, balancer, max(c.opts.failover, 1), fn)
+}
+
+// doAttempts 是 do 的实现，最多尝试 attempts 个不同的客户端
+func (c *ClientPool[T]) doAttempts(ctx context.Context, balancer BalancerType, attempts int, fn func(ctx context.Context, client T) error) (string, error) {
+	if fn == nil {
+		return "", ErrNilFunc
+	}
+	// 请求已取消时不选择客户端，避免污染失败计数
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := c.enter(); err != nil {
+		return "", err
+	}
+	defer c.leave()
+	var tried map[clientWrapper.ClientWrapped[T]]bool
+	var lastID string
+	var lastErr error
+	for i := 0; i < attempts; {
+		cw, err := c.pick(ctx, balancer, tried)
+		if err != nil {
+			// 已经尝试过时返回业务错误，比“无可用客户端”更有用
+			if lastErr != nil {
+				return lastID, lastErr
+			}
+			return "", c.unavailableError(err)
+		}
+		lastID = cw.GetClientId()
+		err = c.invoke(ctx, cw, fn)
+		if tried == nil {
+			tried = make(map[clientWrapper.ClientWrapped[T]]bool)
+		}
+		tried[cw] = true
+		// 选中后才被熔断的客户端没有执行 fn，换一个客户端且不消耗尝试次数
+		if errors.Is(err, errClientTripped) && ctx.Err() == nil {
+			continue
+		}
+		// 中间件错误与请求取消不是客户端的问题，换客户端也无济于事
+		if err == nil || middleware.IsMiddlewareError(err) || ctx.Err() != nil {
+			return lastID, err
+		}
+		lastErr = err
+		i++
+	}
+	return lastID, lastErr
+}
+
+// invoke 在选中的客户端上执行中间件链与 fn，并根据结果更新熔断状态
+func (c *ClientPool[T]) invoke(ctx context.Context, cw clientWrapper.ClientWrapped[T], fn func(ctx context.Context, client T) error) error {
+	if c.opts.retryObservation {
+		// 最后一次尝试由下面统一标记，这里只记录重试中间件的中间失败
+		ctx = middleware.WithAttemptObserver(ctx, func(err error) {
+			if !middleware.IsMiddlewareError(err) {
+				c.markFail(cw)
+			}
+		})
+	}
+	cw.AddInflight(1)
+	// panic 穿过中间件链（如 WithPanicHandler 再次 panic）时也要释放 inflight 并结束半开探测，
+	// 否则客户端会一直停留在探测中
+	defer func() {
+		if r := recover(); r != nil {
+			cw.AddInflight(-1)
+			c.markFail(cw)
+			panic(r)
+		}
+	}()
 	err := c.executeWithMiddleware(ctx, cw, fn)
+	cw.AddInflight(-1)
 	if err != nil {
-		// 中间件自身的错误（如限流超时）不应标记客户端失败
-		if !middleware.IsMiddlewareError(err) {
-			cw.MarkFail(c.maxFails)
+		// 中间件自身的错误（如限流超时）与调用方主动取消请求都不应标记客户端失败
+		if !middleware.IsMiddlewareError(err) && !errors.Is(err, errClientTripped) && !errors.Is(ctx.Err(), context.Canceled) {
+			c.markFail(cw)
+		} else {
+			c.endProbe(cw)
 		}
 	} else {
-		cw.MarkSuccess()
+		c.markSuccess(cw)
 	}
 	return err
 }
 
+// markFail 记录一次失败并同步熔断状态指标，本次失败导致熔断（连续失败或错误率超限）时计算冷却时间
+func (c *ClientPool[T]) markFail(cw clientWrapper.ClientWrapped[T]) {
+	rateExceeded := c.recordOutcome(cw, true)
+	tripped := cw.MarkFailTripped(c.maxFails)
+	if !tripped && rateExceeded {
+		tripped = cw.Trip()
+	}
+	if tripped {
+		cw.SetCooldown(c.tripCooldown(cw))
+		// 延迟创建的客户端在熔断后重新创建
+		cw.Invalidate()
+	}
+	c.observeState(cw)
+}
+
+// recordOutcome 启用错误率熔断时记录一次请求结果，返回窗口内的错误率是否超过阈值
+func (c *ClientPool[T]) recordOutcome(cw clientWrapper.ClientWrapped[T], failed bool) bool {
+	r := c.opts.errorRate
+	if r.window <= 0 {
+		return false
+	}
+	total, failures := cw.RecordOutcome(failed, r.window)
+	return total >= r.minRequests && float64(failures)/float64(total) > r.rate
+}
+
+// tripCooldown 计算一次熔断的冷却时间：启用退避时按连续熔断次数增长，
+// 启用抖动时再在其 ±jitter 范围内随机
+func (c *ClientPool[T]) tripCooldown(cw clientWrapper.ClientWrapped[T]) time.Duration {
+	d := c.baseCooldownOf(cw)
+	if c.opts.backoff.base > 0 {
+		d = c.opts.backoff.cooldown(cw.Snapshot().Trips)
+	}
+	if jitter := c.opts.cooldownJitter; jitter > 0 {
+		d = time.Duration(float64(d) * (1 + jitter*(2*c.randFloat64()-1)))
+	}
+	return d
+}
+
+// randIntn 并发安全地返回 [0, n) 内的随机数
+func (c *ClientPool[T]) randIntn(n int) int {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return c.rand.Intn(n)
+}
+
+// randFloat64 并发安全地返回 [0, 1) 内的随机数
+func (c *ClientPool[T]) randFloat64() float64 {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return c.rand.Float64()
+}
+
+// cooldownOf 返回客户端本次熔断的冷却时间，未记录时使用客户端或池的默认值
+func (c *ClientPool[T]) cooldownOf(cw clientWrapper.ClientWrapped[T]) time.Duration {
+	if d := cw.GetCooldown(); d > 0 {
+		return d
+	}
+	return c.baseCooldownOf(cw)
+}
+
+// baseCooldownOf 返回客户端单独指定的冷却时间，未指定时返回池的 cooldown
+func (c *ClientPool[T]) baseCooldownOf(cw clientWrapper.ClientWrapped[T]) time.Duration {
+	if d := cw.BaseCooldown(); d > 0 {
+		return d
+	}
+	return c.cooldown
+}
+
+// markSuccess 记录一次成功并同步熔断状态指标，启用退避时连续成功 maxFails 次后重置退避
+func (c *ClientPool[T]) markSuccess(cw clientWrapper.ClientWrapped[T]) {
+	c.recordOutcome(cw, false)
+	cw.MarkSuccess()
+	if c.opts.backoff.base > 0 {
+		if s := cw.Snapshot(); s.Trips > 0 && s.Successes >= max(c.maxFails, 1) {
+			cw.ResetTrips()
+		}
+	}
+	c.observeState(cw)
+}
+
+// endProbe 释放半开探测名额并同步熔断状态指标
+func (c *ClientPool[T]) endProbe(cw clientWrapper.ClientWrapped[T]) {
+	cw.EndProbe()
+	c.observeState(cw)
+}
+
 // 随机选择可用的client
 func (c *ClientPool[T]) DoRandomClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
-	cw, err := c.random()
-	if err != nil {
-		return err
-	}
-	return c.doWithClient(ctx, cw, fn)
+	_, err := c.do(ctx, Random, fn)
+	return err
 }
 
 // 轮询选择可用的client
 func (c *ClientPool[T]) DoRoundRobinClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
-	cw, err := c.roundRobin()
-	if err != nil {
-		return err
-	}
-	return c.doWithClient(ctx, cw, fn)
+	_, err := c.do(ctx, RoundRobin, fn)
+	return err
 }
 
 // 按权重随机选择可用的client
 func (c *ClientPool[T]) DoWeightedRandomClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
-	cw, err := c.weightedRandom()
-	if err != nil {
-		return err
+	_, err := c.do(ctx, WeightedRandom, fn)
+	return err
+}
+
+// 按平滑加权轮询选择可用的client
+func (c *ClientPool[T]) DoSmoothWeightedClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
+	_, err := c.do(ctx, SmoothWeightedRoundRobin, fn)
+	return err
+}
+
+// 按加权最少连接选择可用的client
+func (c *ClientPool[T]) DoWeightedLeastConnectionsClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
+	_, err := c.do(ctx, WeightedLeastConnections, fn)
+	return err
+}
+
+// 使用 WithBalancerFunc 配置的函数选择client
+func (c *ClientPool[T]) DoCustomClient(ctx context.Context, fn func(ctx context.Context, client T) error) error {
+	_, err := c.do(ctx, CustomBalancer, fn)
+	return err
+}
+
+// enter 登记一个进行中的请求，池已关闭时返回 ErrPoolClosed
+func (c *ClientPool[T]) enter() error {
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	if c.closed {
+		return ErrPoolClosed
 	}
-	return c.doWithClient(ctx, cw, fn)
+	c.inflight++
+	return nil
 }
 
-// Close 关闭池中所有实现了 io.Closer 的客户端
+// leave 结束一个进行中的请求
+func (c *ClientPool[T]) leave() {
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	c.inflight--
+	if c.inflight == 0 && c.idle != nil {
+		close(c.idle)
+		c.idle = nil
+	}
+}
+
+// addBackground 登记后台任务的停止函数，池已关闭时立即停止该任务
+func (c *ClientPool[T]) addBackground(stop func()) {
+	c.lifeMu.Lock()
+	if !c.closed {
+		c.stops = append(c.stops, stop)
+		c.lifeMu.Unlock()
+		return
+	}
+	c.lifeMu.Unlock()
+	stop()
+}
+
+// Close 关闭池：拒绝新的请求（返回 ErrPoolClosed），等待进行中的请求结束，
+// 停止健康检查等后台任务，并关闭池中所有实现了 io.Closer 的客户端。重复调用返回 nil。
+// Close 不限制等待时间，需要超时时使用 Shutdown。
+// 不要在 Do 等方法的业务函数中调用 Close：该请求自身一直在进行中，Close 永远不会返回
 func (c *ClientPool[T]) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown 与 Close 相同，但最多等待到 ctx 结束：超时时返回 ctx.Err()，池保持拒绝新请求，
+// 后台任务与客户端不会被关闭（仍有请求在使用它们），之后可以再次调用 Shutdown 或 Close 继续等待。
+// 在业务函数中调用时同样会一直等到 ctx 结束
+func (c *ClientPool[T]) Shutdown(ctx context.Context) error {
+	c.lifeMu.Lock()
+	c.closed = true
+	if c.shutdown {
+		c.lifeMu.Unlock()
+		return nil
+	}
+	if c.inflight > 0 {
+		if c.idle == nil {
+			c.idle = make(chan struct{})
+		}
+		idle := c.idle
+		c.lifeMu.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.lifeMu.Lock()
+	}
+	// 并发的 Shutdown 只有一个执行清理
+	if c.shutdown {
+		c.lifeMu.Unlock()
+		return nil
+	}
+	c.shutdown = true
+	stops := c.stops
+	c.stops = nil
+	c.lifeMu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var errs []error
 	for _, cw := range c.clients {
-		if closer, ok := any(cw.GetClient()).(io.Closer); ok {
+		client, built := cw.Built()
+		if !built {
+			c.forgetState(cw)
+			continue
+		}
+		if closer, ok := any(client).(io.Closer); ok {
 			if err := closer.Close(); err != nil {
 				errs = append(errs, err)
 			}
 		}
+		c.forgetState(cw)
 	}
 	c.clients = nil
+	c.invalidateRing()
 	return errors.Join(errs...)
 }
@@ -2,15 +2,23 @@ package clientPool
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bighu630/clientPool/clientWrapper"
 	"github.com/bighu630/clientPool/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type HTTPClient struct {
@@ -209,3 +217,2078 @@ func BenchmarkClientPool(b *testing.B) {
 		}
 	})
 }
+
+// fakeClient 不依赖网络的测试客户端
+type fakeClient struct {
+	name string
+}
+
+var errFake = errors.New("fake error")
+
+func TestClientPool_CircuitStateMetric(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(true))
+	pool.AddClient(&fakeClient{name: "metric_client"}, "metric_client", 1)
+	gauge := circuitState.WithLabelValues("metric_client")
+
+	if v := testutil.ToFloat64(gauge); v != circuitClosed {
+		t.Fatalf("expected closed state, got %v", v)
+	}
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		return errFake
+	})
+	if v := testutil.ToFloat64(gauge); v != circuitOpen {
+		t.Fatalf("expected open state, got %v", v)
+	}
+}
+
+func TestClientPool_SelectionsMetric(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(true))
+	for _, id := range []string{"select_a", "select_b", "select_c"} {
+		pool.AddClient(&fakeClient{name: id}, id, 1)
+	}
+	fn := func(ctx context.Context, client *fakeClient) error {
+		if client.name == "select_c" {
+			return errFake
+		}
+		return nil
+	}
+	// 第一轮 c 失败后熔断，之后只在 a b 之间轮询
+	for i := 0; i < 7; i++ {
+		_ = pool.Do(context.Background(), fn)
+	}
+	expected := map[string]float64{"select_a": 3, "select_b": 3, "select_c": 1}
+	for id, want := range expected {
+		if v := testutil.ToFloat64(selectionsTotal.WithLabelValues(id, string(RoundRobin))); v != want {
+			t.Fatalf("expected %v selections of %s, got %v", want, id, v)
+		}
+	}
+
+	pool.RemoveClient("select_c")
+	if selectionsTotal.DeleteLabelValues("select_c", string(RoundRobin)) {
+		t.Fatal("expected selections of removed client to be deleted")
+	}
+}
+
+func TestRegisterOrReuse(t *testing.T) {
+	newGauge := func() *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "clientpool_circuit_state", Help: "test"}, []string{"client"})
+	}
+	reg := prometheus.NewRegistry()
+	existing := newGauge()
+	reg.MustRegister(existing)
+
+	// 程序已经注册了同名指标时复用它，而不是 panic
+	if got := middleware.RegisterOrReuse(reg, newGauge()); got != existing {
+		t.Fatal("expected the already registered collector to be reused")
+	}
+}
+
+func TestClientPool_WithoutMetrics(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "no_metric_client"}, "no_metric_client", 1)
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		return errFake
+	})
+	if circuitState.DeleteLabelValues("no_metric_client") || selectionsTotal.DeleteLabelValues("no_metric_client", string(RoundRobin)) {
+		t.Fatal("metric should not be recorded when metrics are disabled")
+	}
+}
+
+func TestClientPool_ClientState(t *testing.T) {
+	pool := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "state_client"}, "state_client", 1)
+	cw := pool.GetClientPool()[0]
+	failFn := func(ctx context.Context, client *fakeClient) error { return errFake }
+
+	if s := cw.State(); s != clientWrapper.StateClosed {
+		t.Fatalf("expected %q, got %q", clientWrapper.StateClosed, s)
+	}
+	_ = pool.Do(context.Background(), failFn)
+	if s := cw.State(); s != clientWrapper.StateClosed {
+		t.Fatalf("expected %q below maxFails, got %q", clientWrapper.StateClosed, s)
+	}
+	_ = pool.Do(context.Background(), failFn)
+	if s := cw.State(); s != clientWrapper.StateOpen {
+		t.Fatalf("expected %q, got %q", clientWrapper.StateOpen, s)
+	}
+}
+
+func TestClientPool_Freshness(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false), WithFreshness(time.Hour))
+	pool.AddClient(&fakeClient{name: "fresh"}, "fresh", 1)
+	pool.AddClient(&fakeClient{name: "stale"}, "stale", 1)
+
+	var served []string
+	fn := func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		return nil
+	}
+	// 第一次没有新鲜客户端，退回到轮询顺序；之后 fresh 一直新鲜
+	for i := 0; i < 5; i++ {
+		if err := pool.Do(context.Background(), fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range served {
+		if name != "fresh" {
+			t.Fatalf("expected only fresh client to be selected, got %v", served)
+		}
+	}
+
+	// 没有任何新鲜客户端时退回到可用客户端
+	stalePool := NewClientPool[*fakeClient](3, time.Hour, WeightedRandom, WithMetrics(false), WithFreshness(time.Nanosecond))
+	stalePool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	for i := 0; i < 3; i++ {
+		if err := stalePool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil }); err != nil {
+			t.Fatalf("expected fallback to stale client, got %v", err)
+		}
+	}
+}
+
+func TestClientPool_CancelledContext(t *testing.T) {
+	for _, balancer := range []BalancerType{RoundRobin, WeightedRandom, Random} {
+		pool := NewClientPool[*fakeClient](1, time.Hour, balancer, WithMetrics(false))
+		pool.AddClient(&fakeClient{name: "cancel_client"}, "cancel_client", 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		called := false
+		err := pool.Do(ctx, func(ctx context.Context, client *fakeClient) error {
+			called = true
+			return errFake
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected context.Canceled, got %v", balancer, err)
+		}
+		if called {
+			t.Fatalf("%s: business function should not run with a cancelled context", balancer)
+		}
+		if pool.GetClientPool()[0].IsUnavailable() {
+			t.Fatalf("%s: client should not be marked failed", balancer)
+		}
+	}
+}
+
+func TestClientPool_Failover(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false), WithFailover(2))
+	pool.AddClient(&fakeClient{name: "broken"}, "broken", 1)
+	pool.AddClient(&fakeClient{name: "healthy"}, "healthy", 1)
+
+	var served []string
+	err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		if client.name == "broken" {
+			return errFake
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected failover to succeed, got %v", err)
+	}
+	if len(served) != 2 || served[0] != "broken" || served[1] != "healthy" {
+		t.Fatalf("unexpected attempts: %v", served)
+	}
+
+	// 所有客户端都失败时返回最后一个错误
+	err = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		return fmt.Errorf("%s: %w", client.name, errFake)
+	})
+	if !errors.Is(err, errFake) {
+		t.Fatalf("expected last error, got %v", err)
+	}
+}
+
+func TestClientPool_DoWithRetry(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "broken"}, "broken", 1)
+	pool.AddClient(&fakeClient{name: "good1"}, "good1", 1)
+	pool.AddClient(&fakeClient{name: "good2"}, "good2", 1)
+
+	var served []string
+	err := pool.DoWithRetry(context.Background(), 3, func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		if client.name == "broken" {
+			return errFake
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected retry on another client to succeed, got %v", err)
+	}
+	if len(served) != 2 || served[0] != "broken" || served[1] == "broken" {
+		t.Fatalf("expected broken then a different client, got %v", served)
+	}
+
+	// 已失败的客户端不会在同一次调用中再次被选中
+	served = nil
+	err = pool.DoWithRetry(context.Background(), 5, func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		return errFake
+	})
+	if !errors.Is(err, errFake) {
+		t.Fatalf("expected last error, got %v", err)
+	}
+	if len(served) != 3 {
+		t.Fatalf("expected each client to be tried once, got %v", served)
+	}
+}
+
+func TestClientPool_Stats(t *testing.T) {
+	pool := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false))
+	for i, name := range []string{"stat_a", "stat_b", "stat_c"} {
+		pool.AddClient(&fakeClient{name: name}, name, i+1)
+	}
+	fn := func(ctx context.Context, client *fakeClient) error {
+		if client.name == "stat_b" {
+			return errFake
+		}
+		return nil
+	}
+	// 轮询 6 次，stat_b 失败 2 次达到 maxFails
+	for i := 0; i < 6; i++ {
+		_ = pool.DoRoundRobinClient(context.Background(), fn)
+	}
+
+	stats := pool.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 stats, got %d", len(stats))
+	}
+	for i, s := range stats {
+		if s.Weight != i+1 {
+			t.Errorf("%s: expected weight %d, got %d", s.ID, i+1, s.Weight)
+		}
+		if s.ID == "stat_b" {
+			if !s.Unavailable || s.FailCount != 2 || s.LastFail.IsZero() || s.State != clientWrapper.StateOpen {
+				t.Errorf("unexpected stat for failed client: %+v", s)
+			}
+			continue
+		}
+		if s.Unavailable || s.FailCount != 0 || s.State != clientWrapper.StateClosed {
+			t.Errorf("unexpected stat for healthy client: %+v", s)
+		}
+	}
+}
+
+func TestClientPool_HealthCheck(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "hc_healthy"}, "hc_healthy", 1)
+	pool.AddClient(&fakeClient{name: "hc_broken"}, "hc_broken", 1)
+	_ = pool.DoRoundRobinClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil })
+	_ = pool.DoRoundRobinClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	broken := pool.GetClientPool()[1]
+	if !broken.IsUnavailable() {
+		t.Fatal("expected hc_broken to be unavailable")
+	}
+
+	var mu sync.Mutex
+	probed := map[string]int{}
+	stop := pool.StartHealthCheck(10*time.Millisecond, func(ctx context.Context, client *fakeClient) error {
+		mu.Lock()
+		defer mu.Unlock()
+		probed[client.name]++
+		return nil
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for broken.IsUnavailable() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	stop() // 可重复调用
+
+	if broken.IsUnavailable() {
+		t.Fatal("expected health check to recover hc_broken")
+	}
+	mu.Lock()
+	total := probed["hc_broken"] + probed["hc_healthy"]
+	if probed["hc_healthy"] != 0 {
+		t.Errorf("available client should not be probed, got %d probes", probed["hc_healthy"])
+	}
+	mu.Unlock()
+
+	// stop 之后不再探测
+	_ = pool.DoRoundRobinClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if probed["hc_broken"]+probed["hc_healthy"] != total {
+		t.Error("health check kept probing after stop")
+	}
+}
+
+func TestClientPool_HealthCheckInvalidInterval(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	defer pool.Close()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected StartHealthCheck to panic on a non-positive interval")
+		}
+	}()
+	pool.StartHealthCheck(0, func(ctx context.Context, client *fakeClient) error { return nil })
+}
+
+func TestClientPool_Close(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "close_client"}, "close_client", 1)
+	stop := pool.StartHealthCheck(time.Millisecond, func(ctx context.Context, client *fakeClient) error { return nil })
+	defer stop()
+
+	// 进行中的请求在 Close 前完成
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			close(finished)
+			return nil
+		})
+	}()
+	<-started
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Close returned before the in-flight request finished")
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatalf("second Close should be a no-op, got %v", err)
+	}
+
+	err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil })
+	if !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+// closableClient 记录是否被池关闭
+type closableClient struct {
+	closed atomic.Bool
+}
+
+func (c *closableClient) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestClientPool_ShutdownTimeout(t *testing.T) {
+	pool := NewClientPool[*closableClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	client := &closableClient{}
+	pool.AddClient(client, "stuck", 1)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *closableClient) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// 卡住的请求不会让 Shutdown 永远等待，超时后客户端仍未关闭
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if client.closed.Load() {
+		t.Fatal("client should not be closed while a request is still running")
+	}
+	if err := pool.Do(context.Background(), func(ctx context.Context, client *closableClient) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected new requests to be rejected after Shutdown, got %v", err)
+	}
+
+	close(release)
+	<-done
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !client.closed.Load() {
+		t.Fatal("expected Close to close the client after the request finished")
+	}
+}
+
+func TestClientPool_SmoothWeightedRoundRobin(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, SmoothWeightedRoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 5)
+	pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+	pool.AddClient(&fakeClient{name: "c"}, "c", 1)
+
+	var served []string
+	for i := 0; i < 14; i++ {
+		err := pool.DoSmoothWeightedClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			served = append(served, client.name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nginx 平滑加权轮询在权重 5/1/1 下的经典序列，每 7 次一个周期
+	want := []string{"a", "a", "b", "a", "c", "a", "a", "a", "a", "b", "a", "c", "a", "a"}
+	if fmt.Sprint(served) != fmt.Sprint(want) {
+		t.Fatalf("unexpected sequence:\n got %v\nwant %v", served, want)
+	}
+}
+
+func TestClientPool_HalfOpenSingleProbe(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, 20*time.Millisecond, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "half_open"}, "half_open", 1)
+	cw := pool.GetClientPool()[0]
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	if cw.State() != clientWrapper.StateOpen {
+		t.Fatalf("expected open, got %s", cw.State())
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	var probes atomic.Int32
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+				probes.Add(1)
+				<-release
+				return nil
+			})
+		}()
+	}
+	// 等探测请求进入后再放行
+	for probes.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if cw.State() != clientWrapper.StateHalfOpen {
+		t.Errorf("expected half-open during probe, got %s", cw.State())
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := probes.Load(); n != 1 {
+		t.Fatalf("expected exactly one probe during half-open, got %d", n)
+	}
+	if cw.State() != clientWrapper.StateClosed {
+		t.Fatalf("expected closed after successful probe, got %s", cw.State())
+	}
+}
+
+func TestClientPool_RegisterMiddlewareAt(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "order"}, "order", 1)
+
+	var order []string
+	instrumented := func(name string) middleware.Middleware[*fakeClient] {
+		return middleware.WrapMiddleware(func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient], next func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient]) error) error {
+			order = append(order, name)
+			return next(ctx, client)
+		})
+	}
+	pool.RegisterMiddleware(instrumented("b"))
+	pool.RegisterMiddlewareAt(0, instrumented("a"))   // 包住 recover
+	pool.RegisterMiddlewareAt(100, instrumented("c")) // 越界追加到最内层
+
+	err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		order = append(order, "fn")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(order) != "[a b c fn]" {
+		t.Fatalf("unexpected execution order: %v", order)
+	}
+}
+
+func TestClientPool_RetryObservation(t *testing.T) {
+	for _, observe := range []bool{false, true} {
+		pool := NewClientPool[*fakeClient](10, time.Hour, RoundRobin, WithMetrics(false), WithRetryObservation(observe))
+		pool.RegisterMiddleware(middleware.NewRetryMiddlewareWithConfig[*fakeClient](3, time.Millisecond))
+		pool.AddClient(&fakeClient{name: "retry_client"}, "retry_client", 1)
+
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+
+		want := 1
+		if observe {
+			want = 3
+		}
+		if got := pool.Stats()[0].FailCount; got != want {
+			t.Errorf("observe=%v: expected fail count %d, got %d", observe, want, got)
+		}
+	}
+}
+
+func TestClientPool_DoWithClient(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"a", "b", "c"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+
+	for i, want := range []string{"a", "b", "c", "a"} {
+		var served string
+		id, err := pool.DoWithClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			served = client.name
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want || id != served {
+			t.Fatalf("request %d: expected %q, got id %q (served by %q)", i, want, id, served)
+		}
+	}
+
+	// fn 失败时仍返回客户端ID
+	id, err := pool.DoWithClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	if id != "b" || !errors.Is(err, errFake) {
+		t.Fatalf("expected id b with errFake, got %q, %v", id, err)
+	}
+
+	// 没有可用客户端时返回空字符串
+	empty := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	id, err = empty.DoWithClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil })
+	if id != "" || !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected empty id with NoAvailableClientError, got %q, %v", id, err)
+	}
+}
+
+func TestClientPool_ConsistentHash(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, ConsistentHash, WithMetrics(false))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	serve := func(key string) string {
+		var served string
+		err := pool.DoHashedClient(context.Background(), key, func(ctx context.Context, client *fakeClient) error {
+			served = client.name
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return served
+	}
+
+	keys := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		keys[key] = serve(key)
+		for j := 0; j < 3; j++ {
+			if got := serve(key); got != keys[key] {
+				t.Fatalf("key %s moved from %s to %s", key, keys[key], got)
+			}
+		}
+	}
+
+	// 熔断一个客户端后，只有它的 key 被重新分配，且稳定落到同一个新客户端
+	const key = "session-0"
+	down := keys[key]
+	_ = pool.DoHashedClient(context.Background(), key, func(ctx context.Context, client *fakeClient) error { return errFake })
+	moved := serve(key)
+	if moved == down {
+		t.Fatalf("key %s should move away from unavailable client %s", key, down)
+	}
+	if got := serve(key); got != moved {
+		t.Fatalf("key %s should consistently map to %s, got %s", key, moved, got)
+	}
+	for k, owner := range keys {
+		if owner != down {
+			if got := serve(k); got != owner {
+				t.Fatalf("key %s on healthy client %s moved to %s", k, owner, got)
+			}
+		}
+	}
+}
+
+func TestClientPool_HashRingLazy(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("heavy-%d", i)
+		pool.AddClient(&fakeClient{name: id}, id, 10000)
+	}
+	// 不使用一致性哈希时不构建哈希环
+	if pool.ring != nil {
+		t.Fatalf("expected no hash ring before consistent hashing is used, got %d nodes", len(pool.ring))
+	}
+
+	if err := pool.DoHashedClient(context.Background(), "key", func(ctx context.Context, client *fakeClient) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if want := 10 * hashMaxWeight * hashReplicas; len(pool.ring) != want {
+		t.Fatalf("expected virtual nodes to be capped at %d, got %d", want, len(pool.ring))
+	}
+
+	pool.RemoveClient("heavy-0")
+	if pool.ring != nil {
+		t.Fatal("expected removing a client to invalidate the hash ring")
+	}
+}
+
+func TestClientPool_AddClientWithState(t *testing.T) {
+	for _, balancer := range []BalancerType{RoundRobin, WeightedRandom, Random, SmoothWeightedRoundRobin} {
+		pool := NewClientPool[*fakeClient](3, 50*time.Millisecond, balancer, WithMetrics(false))
+		pool.AddClientWithState(&fakeClient{name: "down"}, "down", 1, false)
+		if s := pool.GetClientPool()[0].State(); s != clientWrapper.StateOpen {
+			t.Fatalf("%s: expected %q, got %q", balancer, clientWrapper.StateOpen, s)
+		}
+		fn := func(ctx context.Context, client *fakeClient) error { return nil }
+		if err := pool.Do(context.Background(), fn); !errors.Is(err, NoAvailableClientError) {
+			t.Fatalf("%s: expected NoAvailableClientError before cooldown, got %v", balancer, err)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if err := pool.Do(context.Background(), fn); err != nil {
+			t.Fatalf("%s: expected client to be picked after cooldown, got %v", balancer, err)
+		}
+	}
+}
+
+func TestClientPool_AddClientChecked(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	if err := pool.AddClientChecked(&fakeClient{name: "a"}, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	err := pool.AddClientChecked(&fakeClient{name: "a2"}, "a", 2)
+	if !errors.Is(err, ErrDuplicateClientID) {
+		t.Fatalf("expected ErrDuplicateClientID, got %v", err)
+	}
+	clients := pool.GetClientPool()
+	if len(clients) != 1 || clients[0].GetClient().name != "a" {
+		t.Fatalf("pool should be unchanged after duplicate add, got %d clients", len(clients))
+	}
+}
+
+func TestClientPool_ReplaceClients(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+	// 熔断 a
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+
+	specs := []ClientSpec[*fakeClient]{
+		{Client: &fakeClient{name: "a"}, ID: "a", Weight: 1},
+		{Client: &fakeClient{name: "c"}, ID: "c", Weight: 2},
+	}
+	if err := pool.ReplaceClients(specs, true); err != nil {
+		t.Fatal(err)
+	}
+	stats := pool.Stats()
+	if len(stats) != 2 || stats[0].ID != "a" || stats[1].ID != "c" {
+		t.Fatalf("unexpected clients after replace: %+v", stats)
+	}
+	if stats[0].State != clientWrapper.StateOpen {
+		t.Fatalf("expected a to keep its open state, got %q", stats[0].State)
+	}
+	if err := pool.ReplaceClients(specs, false); err != nil {
+		t.Fatal(err)
+	}
+	if s := pool.Stats()[0].State; s != clientWrapper.StateClosed {
+		t.Fatalf("expected a to start closed without keepState, got %q", s)
+	}
+
+	dup := append(specs, ClientSpec[*fakeClient]{Client: &fakeClient{name: "c2"}, ID: "c"})
+	if err := pool.ReplaceClients(dup, false); !errors.Is(err, ErrDuplicateClientID) {
+		t.Fatalf("expected ErrDuplicateClientID, got %v", err)
+	}
+	if n := len(pool.Stats()); n != 2 {
+		t.Fatalf("pool should be unchanged after failed replace, got %d clients", n)
+	}
+}
+
+func TestClientPool_ReplaceClientsConcurrent(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "init"}, "init", 1)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, balancer := range []BalancerType{RoundRobin, WeightedRandom, Random, SmoothWeightedRoundRobin} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				_, _ = pool.do(context.Background(), balancer, func(ctx context.Context, client *fakeClient) error {
+					return nil
+				})
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		specs := make([]ClientSpec[*fakeClient], i%4)
+		for j := range specs {
+			name := fmt.Sprintf("c%d", j)
+			specs[j] = ClientSpec[*fakeClient]{Client: &fakeClient{name: name}, ID: name, Weight: j + 1}
+		}
+		if err := pool.ReplaceClients(specs, i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestClientPool_RoundRobinConcurrent(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	names := []string{"a", "b", "c", "d"}
+	for _, name := range names {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				err := pool.DoRoundRobinClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+					mu.Lock()
+					counts[client.name]++
+					mu.Unlock()
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 所有客户端都可用时每个位置只被领取一次，分布严格均匀
+	for _, name := range names {
+		if counts[name] != 400 {
+			t.Fatalf("expected even distribution, got %v", counts)
+		}
+	}
+}
+
+// TestClientPool_RandomConcurrent 在 -race 下验证随机类负载均衡器并发使用随机数生成器是安全的
+func TestClientPool_RandomConcurrent(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, Random, WithMetrics(false))
+	for i, name := range []string{"a", "b", "c"} {
+		pool.AddClient(&fakeClient{name: name}, name, i+1)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ok := func(ctx context.Context, client *fakeClient) error { return nil }
+				if err := pool.DoRandomClient(context.Background(), ok); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := pool.DoWeightedRandomClient(context.Background(), ok); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientPool_SelectWhileMarking(t *testing.T) {
+	for _, balancer := range []BalancerType{RoundRobin, WeightedRandom, Random, SmoothWeightedRoundRobin} {
+		pool := NewClientPool[*fakeClient](2, time.Millisecond, balancer, WithMetrics(false), WithFreshness(time.Millisecond))
+		for i, name := range []string{"a", "b", "c"} {
+			pool.AddClient(&fakeClient{name: name}, name, i+1)
+		}
+		clients := pool.GetClientPool()
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for i, cw := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; ; n++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					switch (n + i) % 3 {
+					case 0:
+						cw.MarkFail(2)
+					case 1:
+						cw.MarkSuccess()
+					default:
+						cw.ResetAvailable()
+					}
+				}
+			}()
+		}
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 200; n++ {
+					_, _ = pool.do(context.Background(), balancer, func(ctx context.Context, client *fakeClient) error {
+						if n%5 == 0 {
+							return errFake
+						}
+						return nil
+					})
+					_ = pool.Stats()
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+		wg.Wait()
+	}
+}
+
+func TestClientPool_CooldownJitter(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+	pool := NewClientPool[*fakeClient](1, cooldown, RoundRobin, WithMetrics(false), WithCooldownJitter(0.5))
+	pool.AddClient(&fakeClient{name: "tripped"}, "tripped", 1)
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("c%d", i)
+		pool.AddClientWithState(&fakeClient{name: name}, name, 1, false)
+	}
+
+	lo, hi := time.Duration(1<<62), time.Duration(0)
+	for _, cw := range pool.GetClientPool() {
+		d := cw.GetCooldown()
+		if d < cooldown/2 || d > cooldown*3/2 {
+			t.Fatalf("%s: cooldown %v outside jitter window", cw.GetClientId(), d)
+		}
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	// 50 个样本应当覆盖抖动窗口的大部分
+	if lo > cooldown*4/5 || hi < cooldown*6/5 {
+		t.Fatalf("cooldowns not spread across jitter window: min %v, max %v", lo, hi)
+	}
+
+	// 未启用抖动时冷却时间固定
+	fixed := NewClientPool[*fakeClient](1, cooldown, RoundRobin, WithMetrics(false))
+	fixed.AddClient(&fakeClient{name: "a"}, "a", 1)
+	_ = fixed.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	if d := fixed.GetClientPool()[0].GetCooldown(); d != cooldown {
+		t.Fatalf("expected cooldown %v without jitter, got %v", cooldown, d)
+	}
+}
+
+func TestClientPool_Backoff(t *testing.T) {
+	pool := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false),
+		WithBackoff(10*time.Millisecond, 80*time.Millisecond, 2))
+	pool.AddClient(&fakeClient{name: "flappy"}, "flappy", 1)
+	cw := pool.GetClientPool()[0]
+
+	pool.markFail(cw)
+	pool.markFail(cw)
+	var got []time.Duration
+	got = append(got, cw.GetCooldown())
+	// 每次冷却结束后的探测都失败
+	for i := 0; i < 4; i++ {
+		if !cw.TryProbe() {
+			t.Fatal("expected to acquire the probe")
+		}
+		pool.markFail(cw)
+		got = append(got, cw.GetCooldown())
+	}
+	want := []time.Duration{10, 20, 40, 80, 80}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("unexpected cooldowns:\n got %v\nwant %v", got, want)
+	}
+
+	// 一次成功不足以重置退避，连续成功 maxFails 次后重新从 base 开始
+	cw.TryProbe()
+	pool.markSuccess(cw)
+	pool.markFail(cw)
+	pool.markFail(cw)
+	if d := cw.GetCooldown(); d != 80*time.Millisecond {
+		t.Fatalf("expected backoff to keep growing after a single success, got %v", d)
+	}
+	cw.TryProbe()
+	pool.markSuccess(cw)
+	pool.markSuccess(cw)
+	pool.markFail(cw)
+	pool.markFail(cw)
+	if d := cw.GetCooldown(); d != 10*time.Millisecond {
+		t.Fatalf("expected backoff to reset after sustained success, got %v", d)
+	}
+}
+
+func TestClientPool_DoAll(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+		for _, name := range []string{"a", "b", "c", "d"} {
+			pool.AddClient(&fakeClient{name: name}, name, 1)
+		}
+		// 熔断 b
+		pool.markFail(pool.GetClientPool()[1])
+
+		var mu sync.Mutex
+		calls := make(map[string]int)
+		fn := func(ctx context.Context, client *fakeClient) error {
+			mu.Lock()
+			calls[client.name]++
+			mu.Unlock()
+			if client.name == "d" {
+				return errFake
+			}
+			return nil
+		}
+		var results []ClientResult
+		if concurrent {
+			results = pool.DoAllConcurrent(context.Background(), fn)
+		} else {
+			results = pool.DoAll(context.Background(), fn)
+		}
+
+		if fmt.Sprint(calls) != "map[a:1 c:1 d:1]" {
+			t.Fatalf("concurrent=%v: expected each available client once, got %v", concurrent, calls)
+		}
+		if len(results) != 3 || results[0].ID != "a" || results[1].ID != "c" || results[2].ID != "d" {
+			t.Fatalf("concurrent=%v: unexpected results %+v", concurrent, results)
+		}
+		if results[0].Err != nil || !errors.Is(results[2].Err, errFake) {
+			t.Fatalf("concurrent=%v: unexpected errors %+v", concurrent, results)
+		}
+	}
+}
+
+func TestClientPool_DoAllClosed(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	fn := func(ctx context.Context, client *fakeClient) error { return nil }
+	// 没有可用客户端时返回空结果
+	if results := pool.DoAll(context.Background(), fn); len(results) != 0 {
+		t.Fatalf("expected no results without clients, got %v", results)
+	}
+
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	_ = pool.Close()
+	results := pool.DoAllConcurrent(context.Background(), fn)
+	if len(results) != 1 || results[0].ID != "" || !errors.Is(results[0].Err, ErrPoolClosed) {
+		t.Fatalf("expected a single ErrPoolClosed result, got %v", results)
+	}
+}
+
+func TestClientPool_DoN(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"slow1", "fast", "slow2"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+
+	var calls atomic.Int32
+	start := time.Now()
+	err := pool.DoN(context.Background(), 3, func(ctx context.Context, client *fakeClient) error {
+		calls.Add(1)
+		if client.name == "fast" {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("expected first success, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("DoN should return on the first success, took %v", elapsed)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("expected 3 distinct clients to be tried, got %d", n)
+	}
+	// 关闭池会等待落选的请求退出；被取消的请求不计入失败
+	clients := pool.GetClientPool()
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, cw := range clients {
+		if s := cw.Snapshot(); s.FailCount != 0 {
+			t.Fatalf("%s: cancelled request should not count as a failure", cw.GetClientId())
+		}
+	}
+
+	// 全部失败时返回聚合错误；可用客户端不足 n 个时只在已有客户端上执行
+	pool = NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+	calls.Store(0)
+	err = pool.DoN(context.Background(), 5, func(ctx context.Context, client *fakeClient) error {
+		calls.Add(1)
+		return fmt.Errorf("%s: %w", client.name, errFake)
+	})
+	if !errors.Is(err, errFake) || calls.Load() != 2 {
+		t.Fatalf("expected aggregated error from 2 clients, got %v after %d calls", err, calls.Load())
+	}
+
+	empty := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	if err := empty.DoN(context.Background(), 2, func(ctx context.Context, client *fakeClient) error { return nil }); !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected NoAvailableClientError, got %v", err)
+	}
+}
+
+func TestClientPool_CircuitOpenMetric(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, WeightedRandom, WithMetrics(true))
+	pool.AddClient(&fakeClient{name: "open_metric_client"}, "open_metric_client", 1)
+	counter := circuitOpenTotal.WithLabelValues(string(WeightedRandom))
+	before := testutil.ToFloat64(counter)
+
+	fail := func(ctx context.Context, client *fakeClient) error { return errFake }
+	_ = pool.Do(context.Background(), fail)
+	if v := testutil.ToFloat64(counter); v != before {
+		t.Fatalf("a request that reached a client should not be counted, got %v", v-before)
+	}
+	if err := pool.Do(context.Background(), fail); !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected NoAvailableClientError, got %v", err)
+	}
+	if v := testutil.ToFloat64(counter); v != before+1 {
+		t.Fatalf("expected one rejected request, got %v", v-before)
+	}
+}
+
+func TestClientPool_Drain(t *testing.T) {
+	for _, balancer := range []BalancerType{RoundRobin, WeightedRandom, Random, SmoothWeightedRoundRobin} {
+		pool := NewClientPool[*fakeClient](3, time.Hour, balancer, WithMetrics(false))
+		pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+		pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+		if !pool.DrainClient("a") {
+			t.Fatalf("%s: expected client a to be found", balancer)
+		}
+		if pool.DrainClient("missing") {
+			t.Fatalf("%s: expected unknown client not to be found", balancer)
+		}
+
+		served := make(map[string]int)
+		fn := func(ctx context.Context, client *fakeClient) error {
+			served[client.name]++
+			return nil
+		}
+		for i := 0; i < 20; i++ {
+			if err := pool.Do(context.Background(), fn); err != nil {
+				t.Fatalf("%s: %v", balancer, err)
+			}
+		}
+		if served["a"] != 0 {
+			t.Fatalf("%s: draining client received %d requests", balancer, served["a"])
+		}
+
+		// 排空不是熔断，但状态字符串显示为 draining
+		for _, s := range pool.Stats() {
+			if s.ID == "a" && (!s.Draining || s.Unavailable || s.State != clientWrapper.StateDraining) {
+				t.Fatalf("%s: unexpected stat for draining client: %+v", balancer, s)
+			}
+		}
+
+		pool.UndrainClient("a")
+		if s := pool.GetClientPool()[0].State(); s != clientWrapper.StateClosed {
+			t.Fatalf("%s: expected %q after undrain, got %q", balancer, clientWrapper.StateClosed, s)
+		}
+		for i := 0; i < 20; i++ {
+			if err := pool.Do(context.Background(), fn); err != nil {
+				t.Fatalf("%s: %v", balancer, err)
+			}
+		}
+		if served["a"] == 0 {
+			t.Fatalf("%s: client a should receive requests after undrain", balancer)
+		}
+	}
+}
+
+func TestClientPool_WeightedLeastConnections(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, WeightedLeastConnections, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "light"}, "light", 1)
+	pool.AddClient(&fakeClient{name: "heavy"}, "heavy", 3)
+
+	// 逐个发起阻塞的请求，每个请求开始执行后再发起下一个
+	release := make(chan struct{})
+	started := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+				started <- client.name
+				<-release
+				return nil
+			})
+		}()
+		<-started
+	}
+
+	inflight := make(map[string]int)
+	for _, s := range pool.Stats() {
+		inflight[s.ID] = s.Inflight
+	}
+	if inflight["light"] != 2 || inflight["heavy"] != 6 {
+		t.Fatalf("expected light:2 heavy:6 in flight, got %v", inflight)
+	}
+
+	close(release)
+	wg.Wait()
+	for _, s := range pool.Stats() {
+		if s.Inflight != 0 {
+			t.Fatalf("expected no requests in flight for %s, got %d", s.ID, s.Inflight)
+		}
+	}
+}
+
+func TestClientPool_ClientsUnavailableError(t *testing.T) {
+	fn := func(ctx context.Context, client *fakeClient) error { return nil }
+
+	empty := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	var detail *ClientsUnavailableError
+	if err := empty.Do(context.Background(), fn); !errors.As(err, &detail) || detail.TotalClients != 0 {
+		t.Fatalf("expected empty pool details, got %v", err)
+	}
+
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClientWithState(&fakeClient{name: "a"}, "a", 1, false)
+	pool.AddClientWithState(&fakeClient{name: "b"}, "b", 1, false)
+	pool.AddClient(&fakeClient{name: "c"}, "c", 1)
+	pool.DrainClient("c")
+
+	err := pool.Do(context.Background(), fn)
+	if !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected NoAvailableClientError, got %v", err)
+	}
+	if !errors.As(err, &detail) {
+		t.Fatalf("expected *ClientsUnavailableError, got %T", err)
+	}
+	if detail.TotalClients != 3 || !slices.Equal(detail.UnavailableIDs, []string{"a", "b"}) || !slices.Equal(detail.DrainingIDs, []string{"c"}) {
+		t.Fatalf("unexpected details: %+v", detail)
+	}
+}
+
+func TestClientPool_SuccessThreshold(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, 20*time.Millisecond, RoundRobin, WithMetrics(false), WithSuccessThreshold(2))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	cw := pool.GetClientPool()[0]
+	ok := func(ctx context.Context, client *fakeClient) error { return nil }
+
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	if cw.State() != clientWrapper.StateOpen {
+		t.Fatalf("expected %q after failure, got %q", clientWrapper.StateOpen, cw.State())
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// 第一次探测成功后仍未关闭熔断，但允许下一次探测
+	if err := pool.Do(context.Background(), ok); err != nil {
+		t.Fatal(err)
+	}
+	if !cw.IsUnavailable() {
+		t.Fatal("circuit should stay open after a single successful probe")
+	}
+	if err := pool.Do(context.Background(), ok); err != nil {
+		t.Fatal(err)
+	}
+	if cw.IsUnavailable() || cw.State() != clientWrapper.StateClosed {
+		t.Fatalf("expected circuit closed after two successes, got %q", cw.State())
+	}
+
+	// 半开期间失败会重新计数
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	time.Sleep(30 * time.Millisecond)
+	_ = pool.Do(context.Background(), ok)
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	time.Sleep(30 * time.Millisecond)
+	_ = pool.Do(context.Background(), ok)
+	if !cw.IsUnavailable() {
+		t.Fatal("a failure during half-open should reset the success count")
+	}
+}
+
+func TestClientPool_ErrorRateThreshold(t *testing.T) {
+	// 连续失败阈值足够大，只有错误率会触发熔断
+	pool := NewClientPool[*fakeClient](100, time.Hour, RoundRobin, WithMetrics(false), WithErrorRateThreshold(0.4, time.Minute, 10))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	cw := pool.GetClientPool()[0]
+
+	// 成功与失败交替，第 10 个请求时错误率为 50%
+	for i := 0; i < 9; i++ {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if i%2 == 1 {
+				return errFake
+			}
+			return nil
+		})
+		if cw.IsUnavailable() {
+			t.Fatalf("tripped after %d requests, before reaching minRequests", i+1)
+		}
+	}
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	if cw.State() != clientWrapper.StateOpen {
+		t.Fatalf("expected %q with 50%% errors over the window, got %q", clientWrapper.StateOpen, cw.State())
+	}
+
+	// 错误率低于阈值时不熔断
+	healthy := NewClientPool[*fakeClient](100, time.Hour, RoundRobin, WithMetrics(false), WithErrorRateThreshold(0.4, time.Minute, 10))
+	healthy.AddClient(&fakeClient{name: "b"}, "b", 1)
+	for i := 0; i < 30; i++ {
+		_ = healthy.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if i%3 == 0 {
+				return errFake
+			}
+			return nil
+		})
+	}
+	if healthy.GetClientPool()[0].IsUnavailable() {
+		t.Fatal("client with 33% errors should not trip a 40% threshold")
+	}
+}
+
+func TestClientPool_ClientIDInContext(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"a", "b", "c"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	var seenByMiddleware string
+	pool.RegisterMiddleware(middleware.WrapMiddleware(func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient], next func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient]) error) error {
+		seenByMiddleware = middleware.ClientIDFromContext(ctx)
+		return next(ctx, client)
+	}))
+
+	for i := 0; i < 6; i++ {
+		var seen, served string
+		id, err := pool.DoWithClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			seen, served = middleware.ClientIDFromContext(ctx), client.name
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen != served || seen != id || seenByMiddleware != id {
+			t.Fatalf("expected client id %q everywhere, got fn %q, middleware %q (served by %q)", id, seen, seenByMiddleware, served)
+		}
+	}
+	if id := middleware.ClientIDFromContext(context.Background()); id != "" {
+		t.Fatalf("expected empty id outside the pool, got %q", id)
+	}
+}
+
+func TestClientPool_DoMethod(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	reg := prometheus.NewRegistry()
+	pool.RegisterMiddleware(middleware.NewPrometheusMiddlewareWithRegistry[*fakeClient](reg))
+
+	var method string
+	err := pool.DoMethod(context.Background(), "get_slot", func(ctx context.Context, client *fakeClient) error {
+		method = middleware.GetPrometheusMethodName(ctx)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "get_slot" {
+		t.Fatalf("expected method get_slot in context, got %q", method)
+	}
+
+	expected := `
+# HELP middleware_requests_total Total number of requests handled by middleware
+# TYPE middleware_requests_total counter
+middleware_requests_total{client="a",method="get_slot"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "middleware_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientPool_CustomBalancer(t *testing.T) {
+	// 优先选择 id 最小的可用客户端
+	lowestID := func(clients []ClientView) (int, bool) {
+		best := -1
+		for i, v := range clients {
+			if v.Available && (best < 0 || v.ID < clients[best].ID) {
+				best = i
+			}
+		}
+		return best, best >= 0
+	}
+	pool := NewClientPool[*fakeClient](1, time.Hour, CustomBalancer, WithMetrics(false), WithBalancerFunc(lowestID), WithFailover(3))
+	for _, name := range []string{"c", "a", "b"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+
+	for _, want := range []string{"a", "a"} {
+		id, err := pool.DoWithClient(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil })
+		if err != nil || id != want {
+			t.Fatalf("expected %q, got %q, %v", want, id, err)
+		}
+	}
+
+	// a 失败后熔断，故障转移时不再把它交给选择函数
+	var served []string
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		if client.name == "a" {
+			return errFake
+		}
+		return nil
+	})
+	if !slices.Equal(served, []string{"a", "b"}) {
+		t.Fatalf("expected failover from a to b, got %v", served)
+	}
+	if err := pool.DoCustomClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		return nil
+	}); err != nil || served[len(served)-1] != "b" {
+		t.Fatalf("expected b after a tripped, got %v, %v", served, err)
+	}
+
+	unset := NewClientPool[*fakeClient](1, time.Hour, CustomBalancer, WithMetrics(false))
+	unset.AddClient(&fakeClient{name: "a"}, "a", 1)
+	if err := unset.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return nil }); !errors.Is(err, ErrNoBalancerFunc) {
+		t.Fatalf("expected ErrNoBalancerFunc, got %v", err)
+	}
+}
+
+func TestClientPool_PerClientCooldown(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClientWithConfig(ClientSpec[*fakeClient]{Client: &fakeClient{name: "fast"}, ID: "fast", Weight: 1, Cooldown: 20 * time.Millisecond})
+	pool.AddClientWithConfig(ClientSpec[*fakeClient]{Client: &fakeClient{name: "slow"}, ID: "slow", Weight: 1, Cooldown: 150 * time.Millisecond})
+	pool.AddClient(&fakeClient{name: "default"}, "default", 1)
+	for _, cw := range pool.GetClientPool() {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+		if !cw.IsUnavailable() {
+			t.Fatalf("expected %s to be tripped", cw.GetClientId())
+		}
+	}
+
+	serve := func() map[string]int {
+		served := make(map[string]int)
+		for i := 0; i < 6; i++ {
+			_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+				served[client.name]++
+				return nil
+			})
+		}
+		return served
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if served := serve(); served["fast"] != 6 {
+		t.Fatalf("expected only fast to recover after its cooldown, got %v", served)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if served := serve(); served["slow"] == 0 || served["default"] != 0 {
+		t.Fatalf("expected slow to recover and default (pool cooldown) to stay open, got %v", served)
+	}
+}
+
+func TestClientPool_ExportImportState(t *testing.T) {
+	pool := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"a", "b"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	fail := func(ctx context.Context, client *fakeClient) error {
+		if client.name == "a" {
+			return errFake
+		}
+		return nil
+	}
+	for i := 0; i < 4; i++ {
+		_ = pool.Do(context.Background(), fail)
+	}
+
+	data, err := json.Marshal(pool.ExportState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []WrapperState
+	if err := json.Unmarshal(data, &states); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟重启：新池中 a 仍然熔断，b 保持可用，未知的 id 被忽略
+	restarted := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"a", "b", "c"} {
+		restarted.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	restarted.ImportState(append(states, WrapperState{ID: "unknown", Unavailable: true, FailCount: 1}))
+
+	got := make(map[string]ClientStat)
+	for _, s := range restarted.Stats() {
+		got[s.ID] = s
+	}
+	if a := got["a"]; !a.Unavailable || a.FailCount != 2 || a.State != clientWrapper.StateOpen || a.LastFail.IsZero() {
+		t.Fatalf("expected a to be restored as open, got %+v", a)
+	}
+	if b := got["b"]; b.Unavailable || b.LastSuccess.IsZero() {
+		t.Fatalf("expected b to be restored as available, got %+v", b)
+	}
+	if c := got["c"]; c.Unavailable || !c.LastSuccess.IsZero() {
+		t.Fatalf("expected c to keep its fresh state, got %+v", c)
+	}
+	for i := 0; i < 4; i++ {
+		_ = restarted.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if client.name == "a" {
+				t.Fatal("restored open client should not be picked")
+			}
+			return nil
+		})
+	}
+}
+
+func TestClientPool_AddLazyClient(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, 20*time.Millisecond, RoundRobin, WithMetrics(false))
+	var builds int
+	var buildErr error
+	pool.AddLazyClient("lazy", 1, func() (*fakeClient, error) {
+		if buildErr != nil {
+			return nil, buildErr
+		}
+		builds++
+		return &fakeClient{name: fmt.Sprintf("lazy-%d", builds)}, nil
+	})
+	if builds != 0 {
+		t.Fatal("factory should not be called before the client is selected")
+	}
+
+	var served []string
+	ok := func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := pool.Do(context.Background(), ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if builds != 1 || !slices.Equal(served, []string{"lazy-1", "lazy-1", "lazy-1"}) {
+		t.Fatalf("expected one build reused across requests, got %d builds, served %v", builds, served)
+	}
+
+	// 熔断后丢弃实例，恢复后重新创建
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	time.Sleep(30 * time.Millisecond)
+	if err := pool.Do(context.Background(), ok); err != nil {
+		t.Fatal(err)
+	}
+	if builds != 2 || served[len(served)-1] != "lazy-2" {
+		t.Fatalf("expected client to be rebuilt after a trip, got %d builds, served %v", builds, served)
+	}
+
+	// 工厂函数失败计为客户端失败
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	time.Sleep(30 * time.Millisecond)
+	buildErr = errors.New("dial failed")
+	if err := pool.Do(context.Background(), ok); !errors.Is(err, buildErr) {
+		t.Fatalf("expected factory error, got %v", err)
+	}
+	if s := pool.GetClientPool()[0].State(); s != clientWrapper.StateOpen {
+		t.Fatalf("expected factory failure to trip the client, got %q", s)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientPool_GetClient(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	a, b := &fakeClient{name: "a"}, &fakeClient{name: "b"}
+	pool.AddClient(a, "a", 1)
+	pool.AddClient(b, "b", 1)
+
+	if got, ok := pool.GetClient("b"); !ok || got != b {
+		t.Fatalf("expected client b, got %v, %v", got, ok)
+	}
+	if got, ok := pool.GetClient("missing"); ok || got != nil {
+		t.Fatalf("expected miss for unknown id, got %v, %v", got, ok)
+	}
+}
+
+func TestClientPool_LenAndIDs(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, ConsistentHash, WithMetrics(false))
+	if pool.Len() != 0 || len(pool.IDs()) != 0 {
+		t.Fatalf("expected empty pool, got %d %v", pool.Len(), pool.IDs())
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	if pool.Len() != 3 || !slices.Equal(pool.IDs(), []string{"a", "b", "c"}) {
+		t.Fatalf("expected 3 clients, got %d %v", pool.Len(), pool.IDs())
+	}
+
+	if !pool.RemoveClient("b") || pool.RemoveClient("b") {
+		t.Fatal("expected b to be removed exactly once")
+	}
+	ids := pool.IDs()
+	if pool.Len() != 2 || !slices.Equal(ids, []string{"a", "c"}) {
+		t.Fatalf("expected a and c after removal, got %d %v", pool.Len(), ids)
+	}
+	// 返回的是拷贝
+	ids[0] = "changed"
+	if pool.IDs()[0] != "a" {
+		t.Fatal("IDs should return a copy")
+	}
+
+	// 被移除的客户端不再被选中
+	for i := 0; i < 10; i++ {
+		_ = pool.DoHashedClient(context.Background(), fmt.Sprintf("key-%d", i), func(ctx context.Context, client *fakeClient) error {
+			if client.name == "b" {
+				t.Fatal("removed client should not be picked")
+			}
+			return nil
+		})
+	}
+}
+
+func TestClientPool_AvailableCount(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, 30*time.Millisecond, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+	pool.AddClientWithState(&fakeClient{name: "down"}, "down", 1, false)
+	pool.AddClient(&fakeClient{name: "drained"}, "drained", 1)
+	pool.DrainClient("drained")
+
+	if n := pool.AvailableCount(); n != 2 {
+		t.Fatalf("expected 2 available clients, got %d", n)
+	}
+
+	// 冷却结束后计为可用，但不会占用探测名额
+	time.Sleep(40 * time.Millisecond)
+	if n := pool.AvailableCount(); n != 3 {
+		t.Fatalf("expected 3 available clients after cooldown, got %d", n)
+	}
+	for _, cw := range pool.GetClientPool() {
+		if cw.IsProbing() {
+			t.Fatalf("AvailableCount should not start a probe on %s", cw.GetClientId())
+		}
+	}
+}
+
+func TestClientPool_Healthy(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	pool.AddClientWithState(&fakeClient{name: "b"}, "b", 1, false)
+	if err := pool.Healthy(); err != nil {
+		t.Fatalf("expected healthy with one good client, got %v", err)
+	}
+
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	err := pool.Healthy()
+	var detail *ClientsUnavailableError
+	if !errors.As(err, &detail) || !slices.Equal(detail.UnavailableIDs, []string{"a", "b"}) {
+		t.Fatalf("expected unhealthy listing a and b, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "[a b]") {
+		t.Fatalf("expected error message to list unavailable ids, got %q", err)
+	}
+}
+
+func TestClientPool_AllowDegraded(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false), WithAllowDegraded(true))
+	pool.AddClient(&fakeClient{name: "first"}, "first", 1)
+	pool.AddClient(&fakeClient{name: "second"}, "second", 1)
+
+	fail := func(ctx context.Context, client *fakeClient) error { return errFake }
+	// first 先失败，second 后失败，两者都进入熔断
+	_ = pool.DoRoundRobinClient(context.Background(), fail)
+	time.Sleep(5 * time.Millisecond)
+	_ = pool.DoRoundRobinClient(context.Background(), fail)
+	if pool.AvailableCount() != 0 {
+		t.Fatalf("expected all clients to be open")
+	}
+
+	var served string
+	err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		served = client.name
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected degraded request to proceed, got %v", err)
+	}
+	if served != "first" {
+		t.Fatalf("expected least-recently-failed client first, got %q", served)
+	}
+	// 降级请求成功同样会关闭熔断
+	if pool.GetClientPool()[0].IsUnavailable() {
+		t.Fatalf("expected degraded success to close the breaker")
+	}
+
+	strict := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	strict.AddClientWithState(&fakeClient{name: "open"}, "open", 1, false)
+	if err := strict.Do(context.Background(), fail); !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected NoAvailableClientError without WithAllowDegraded, got %v", err)
+	}
+}
+
+// fakeClock 是只在 Advance 时前进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestClientPool_WithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false), WithClock(clock))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	ok := func(ctx context.Context, client *fakeClient) error { return nil }
+	if err := pool.Do(context.Background(), ok); !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected client to be open, got %v", err)
+	}
+	if got := pool.GetClientPool()[0].GetLastFail(); !got.Equal(clock.Now()) {
+		t.Fatalf("expected last fail from the injected clock, got %v", got)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if err := pool.Do(context.Background(), ok); !errors.Is(err, NoAvailableClientError) {
+		t.Fatalf("expected client to stay open before cooldown ends, got %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if err := pool.Do(context.Background(), ok); err != nil {
+		t.Fatalf("expected recovery after advancing past cooldown, got %v", err)
+	}
+	if pool.GetClientPool()[0].IsUnavailable() {
+		t.Fatalf("expected probe success to close the breaker")
+	}
+}
+
+func TestClientPool_WithSeed(t *testing.T) {
+	sequence := func() []string {
+		pool := NewClientPool[*fakeClient](3, time.Hour, WeightedRandom, WithMetrics(false), WithSeed(42))
+		pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+		pool.AddClient(&fakeClient{name: "b"}, "b", 2)
+		pool.AddClient(&fakeClient{name: "c"}, "c", 3)
+		var seq []string
+		for i := 0; i < 10; i++ {
+			_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+				seq = append(seq, client.name)
+				return nil
+			})
+		}
+		return seq
+	}
+
+	// math/rand 对给定种子的输出是稳定的
+	expected := []string{"c", "c", "b", "a", "b", "b", "c", "b", "b", "b"}
+	for i := 0; i < 2; i++ {
+		if seq := sequence(); !slices.Equal(seq, expected) {
+			t.Fatalf("expected seeded sequence %v, got %v", expected, seq)
+		}
+	}
+}
+
+func TestClientPool_RecheckBeforeInvoke(t *testing.T) {
+	// tripA 模拟其他请求在选中 a 之后、执行 fn 之前把 a 熔断
+	tripA := middleware.WrapMiddleware(func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient], next func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient]) error) error {
+		if client.GetClientId() == "a" {
+			client.MarkUnavailable()
+		}
+		return next(ctx, client)
+	})
+	newPool := func(opts ...Option) *ClientPool[*fakeClient] {
+		pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, append(opts, WithMetrics(false))...)
+		pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+		pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+		pool.RegisterMiddleware(tripA)
+		return pool
+	}
+
+	var served []string
+	fn := func(ctx context.Context, client *fakeClient) error {
+		served = append(served, client.name)
+		return nil
+	}
+	pool := newPool(WithRecheckBeforeInvoke(true))
+	id, err := pool.DoWithClient(context.Background(), fn)
+	if err != nil || id != "b" {
+		t.Fatalf("expected re-selection to b, got %q, %v", id, err)
+	}
+	if !slices.Equal(served, []string{"b"}) {
+		t.Fatalf("expected fn to run only on b, got %v", served)
+	}
+	if s := pool.GetClientPool()[0].Snapshot(); s.FailCount != 1 {
+		t.Fatalf("expected re-selection not to count as a failure of a, got %d", s.FailCount)
+	}
+
+	// 未启用时请求照常在已熔断的客户端上执行
+	served = nil
+	if _, err := newPool().DoWithClient(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(served, []string{"a"}) {
+		t.Fatalf("expected fn to run on a without recheck, got %v", served)
+	}
+}
+
+func TestClientPool_RegisterMiddlewareFor(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "flaky"}, "flaky", 1)
+	pool.AddClient(&fakeClient{name: "stable"}, "stable", 1)
+
+	var wrapped []string
+	pool.RegisterMiddlewareFor([]string{"flaky"}, middleware.WrapMiddleware(func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient], next func(ctx context.Context, client clientWrapper.ClientWrapped[*fakeClient]) error) error {
+		wrapped = append(wrapped, client.GetClientId())
+		return next(ctx, client)
+	}))
+
+	var served []string
+	for i := 0; i < 2; i++ {
+		if err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			served = append(served, client.name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(served, []string{"flaky", "stable"}) {
+		t.Fatalf("expected both clients to serve, got %v", served)
+	}
+	if !slices.Equal(wrapped, []string{"flaky"}) {
+		t.Fatalf("expected middleware to run only for flaky, got %v", wrapped)
+	}
+}
+
+func TestDoWithResult(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false), WithFailover(2))
+	pool.AddClient(&fakeClient{name: "broken"}, "broken", 1)
+	pool.AddClient(&fakeClient{name: "healthy"}, "healthy", 1)
+
+	n, err := DoWithResult(pool, context.Background(), func(ctx context.Context, client *fakeClient) (int, error) {
+		if client.name == "broken" {
+			return -1, errFake
+		}
+		return len(client.name), nil
+	})
+	if err != nil || n != len("healthy") {
+		t.Fatalf("expected result from the healthy client, got %d, %v", n, err)
+	}
+	// 失败的调用同样更新熔断状态
+	if !pool.GetClientPool()[0].IsUnavailable() {
+		t.Fatalf("expected broken client to be open")
+	}
+
+	n, err = DoWithResult(pool, context.Background(), func(ctx context.Context, client *fakeClient) (int, error) {
+		return 42, errFake
+	})
+	if !errors.Is(err, errFake) || n != 0 {
+		t.Fatalf("expected zero value and error, got %d, %v", n, err)
+	}
+}
+
+func TestClientPool_DoWith(t *testing.T) {
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false))
+	for _, name := range []string{"a", "b", "c"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+	serve := func(ctx context.Context, balancer BalancerType) string {
+		var served string
+		if err := pool.DoWith(ctx, balancer, func(ctx context.Context, client *fakeClient) error {
+			served = client.name
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return served
+	}
+
+	// 一致性哈希：相同 key 总是落到同一客户端，不受默认轮询推进的影响
+	ctx := WithHashKey(context.Background(), "session-1")
+	first := serve(ctx, ConsistentHash)
+	for i := 0; i < 5; i++ {
+		if got := serve(ctx, ConsistentHash); got != first {
+			t.Fatalf("expected hashed calls to stick to %s, got %s", first, got)
+		}
+	}
+
+	// 未知策略退回到默认的轮询
+	var seq []string
+	for i := 0; i < 3; i++ {
+		seq = append(seq, serve(context.Background(), BalancerType("unknown")))
+	}
+	slices.Sort(seq)
+	if !slices.Equal(seq, []string{"a", "b", "c"}) {
+		t.Fatalf("expected unknown balancer to fall back to round robin, got %v", seq)
+	}
+}
+
+func TestClientPool_StatsAfterCooldown(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	pool := NewClientPool[*fakeClient](1, time.Minute, RoundRobin, WithMetrics(false), WithClock(clock))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+
+	if s := pool.Stats()[0]; !s.Unavailable || pool.AvailableCount() != 0 {
+		t.Fatalf("expected client to be unavailable during cooldown, got %+v", s)
+	}
+
+	// 冷却结束后无需任何选择，Stats 与 AvailableCount 即报告为可用
+	clock.Advance(2 * time.Minute)
+	if s := pool.Stats()[0]; s.Unavailable || pool.AvailableCount() != 1 {
+		t.Fatalf("expected client to report available after cooldown, got %+v", s)
+	}
+	if s := pool.Stats()[0]; s.State != clientWrapper.StateOpen {
+		t.Fatalf("expected breaker state to stay open until probed, got %s", s.State)
+	}
+}
+
+func TestClientPool_MaxClients(t *testing.T) {
+	pool := NewClientPool[*fakeClient](5, time.Hour, RoundRobin, WithMetrics(false), WithMaxClients(3))
+	for _, name := range []string{"a", "b", "c"} {
+		if _, evicted := pool.AddClientWithEviction(&fakeClient{name: name}, name, 1); evicted {
+			t.Fatalf("unexpected eviction while adding %s", name)
+		}
+	}
+	// 轮询一轮：a、c 成功，b 失败
+	for i := 0; i < 3; i++ {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if client.name == "b" {
+				return errFake
+			}
+			return nil
+		})
+	}
+
+	id, evicted := pool.AddClientWithEviction(&fakeClient{name: "d"}, "d", 1)
+	if !evicted || id != "b" {
+		t.Fatalf("expected the failing client b to be evicted, got %q, %v", id, evicted)
+	}
+	if ids := pool.IDs(); !slices.Equal(ids, []string{"a", "c", "d"}) {
+		t.Fatalf("unexpected clients after eviction: %v", ids)
+	}
+
+	// AddClient 同样受上限约束：都没有失败时淘汰最久没有成功过的 d
+	pool.AddClient(&fakeClient{name: "e"}, "e", 1)
+	if ids := pool.IDs(); !slices.Equal(ids, []string{"a", "c", "e"}) {
+		t.Fatalf("expected d to be evicted, got %v", ids)
+	}
+}
+
+func TestClientPool_NilFunc(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+
+	if err := pool.Do(context.Background(), nil); !errors.Is(err, ErrNilFunc) {
+		t.Fatalf("expected ErrNilFunc, got %v", err)
+	}
+	if err := pool.DoN(context.Background(), 1, nil); !errors.Is(err, ErrNilFunc) {
+		t.Fatalf("expected ErrNilFunc from DoN, got %v", err)
+	}
+	if results := pool.DoAll(context.Background(), nil); len(results) != 1 || !errors.Is(results[0].Err, ErrNilFunc) {
+		t.Fatalf("expected DoAll to report ErrNilFunc, got %v", results)
+	}
+	if s := pool.Stats()[0]; s.Unavailable || s.FailCount != 0 {
+		t.Fatalf("expected no client to be marked failed, got %+v", s)
+	}
+}
+
+func TestClientPool_RandomSkipsUnavailable(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, Random, WithMetrics(false))
+	pool.AddClientWithState(&fakeClient{name: "open"}, "open", 1, false)
+	pool.AddClient(&fakeClient{name: "healthy"}, "healthy", 1)
+
+	for i := 0; i < 50; i++ {
+		var served string
+		if err := pool.DoRandomClient(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			served = client.name
+			return nil
+		}); err != nil {
+			t.Fatalf("expected the healthy client to be chosen, got %v", err)
+		}
+		if served != "healthy" {
+			t.Fatalf("expected healthy, got %s", served)
+		}
+	}
+}
+
+func TestClientPool_Clients(t *testing.T) {
+	pool := NewClientPool[*fakeClient](2, time.Hour, RoundRobin, WithMetrics(false))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 2)
+	pool.AddClient(&fakeClient{name: "b"}, "b", 1)
+	for i := 0; i < 4; i++ {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if client.name == "b" {
+				return errFake
+			}
+			return nil
+		})
+	}
+
+	views := pool.Clients()
+	if len(views) != 2 {
+		t.Fatalf("expected 2 views, got %d", len(views))
+	}
+	a, b := views[0], views[1]
+	if a.ID != "a" || a.Weight != 2 || !a.Available || a.Unavailable || a.FailCount != 0 {
+		t.Fatalf("unexpected view of a: %+v", a)
+	}
+	if b.ID != "b" || b.Available || !b.Unavailable || b.FailCount != 2 || b.LastFail.IsZero() {
+		t.Fatalf("unexpected view of b: %+v", b)
+	}
+
+	// 视图是拷贝，修改它不影响池
+	views[1].Unavailable = false
+	views[1].FailCount = 0
+	if again := pool.Clients()[1]; !again.Unavailable || again.FailCount != 2 {
+		t.Fatalf("expected pool state to be unaffected by modifying a view, got %+v", again)
+	}
+}
+
+func TestClientPool_WithPanicHandler(t *testing.T) {
+	errPanic := errors.New("upstream panicked")
+	var gotID string
+	pool := NewClientPool[*fakeClient](3, time.Hour, RoundRobin, WithMetrics(false), WithPanicHandler(func(ctx context.Context, clientID string, r any) error {
+		gotID = clientID
+		return errPanic
+	}))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+
+	err := pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+		panic("boom")
+	})
+	if !errors.Is(err, errPanic) || gotID != "a" {
+		t.Fatalf("expected the handler's error for client a, got %v (%q)", err, gotID)
+	}
+}
+
+func TestClientPool_WithPanicHandlerRepanicDuringProbe(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	pool := NewClientPool[*fakeClient](1, time.Minute, RoundRobin, WithMetrics(false), WithClock(clock),
+		WithPanicHandler(func(ctx context.Context, clientID string, r any) error { panic(r) }))
+	pool.AddClient(&fakeClient{name: "a"}, "a", 1)
+	ok := func(ctx context.Context, client *fakeClient) error { return nil }
+
+	_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { return errFake })
+	clock.Advance(2 * time.Minute)
+
+	// 半开探测中 panic 并被处理函数再次抛出
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("expected the panic to propagate, got %v", r)
+			}
+		}()
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error { panic("boom") })
+	}()
+
+	a := pool.GetClientPool()[0]
+	if a.Inflight() != 0 || a.IsProbing() {
+		t.Fatalf("expected inflight and probe to be released, got inflight=%d probing=%v", a.Inflight(), a.IsProbing())
+	}
+	if !a.IsUnavailable() {
+		t.Fatalf("expected the failed probe to reopen the breaker")
+	}
+	clock.Advance(2 * time.Minute)
+	if err := pool.Do(context.Background(), ok); err != nil {
+		t.Fatalf("expected recovery after the next cooldown, got %v", err)
+	}
+}
+
+func TestDoBatch(t *testing.T) {
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false), WithFailover(2))
+	for _, name := range []string{"a", "b", "broken"} {
+		pool.AddClient(&fakeClient{name: name}, name, 1)
+	}
+
+	items := make([]int, 20)
+	for i := range items {
+		items[i] = i
+	}
+	var mu sync.Mutex
+	processed := make(map[int]string)
+	errs := DoBatch(pool, context.Background(), items, func(ctx context.Context, client *fakeClient, item int) error {
+		if client.name == "broken" {
+			return errFake
+		}
+		mu.Lock()
+		processed[item] = client.name
+		mu.Unlock()
+		return nil
+	}, 4)
+
+	if len(errs) != len(items) {
+		t.Fatalf("expected one error slot per item, got %d", len(errs))
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("item %d: expected failover to a healthy client, got %v", i, err)
+		}
+	}
+	if len(processed) != len(items) {
+		t.Fatalf("expected all items to be processed, got %d", len(processed))
+	}
+	served := make(map[string]int)
+	for _, name := range processed {
+		served[name]++
+	}
+	if served["a"] == 0 || served["b"] == 0 {
+		t.Fatalf("expected items to be spread across healthy clients, got %v", served)
+	}
+	// broken 第一次失败后熔断，之后不再分发给它
+	if !pool.GetClientPool()[2].IsUnavailable() {
+		t.Fatalf("expected broken client to be open")
+	}
+}
+
+func TestClientPool_WithAutoEvict(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	evicted := make(chan string, 4)
+	pool := NewClientPool[*fakeClient](1, time.Hour, RoundRobin, WithMetrics(false), WithClock(clock),
+		WithAutoEvict(40*time.Millisecond, func(id string) { evicted <- id }))
+	defer pool.Close()
+	pool.AddClient(&fakeClient{name: "dead"}, "dead", 1)
+	pool.AddClient(&fakeClient{name: "alive"}, "alive", 1)
+
+	for i := 0; i < 2; i++ {
+		_ = pool.Do(context.Background(), func(ctx context.Context, client *fakeClient) error {
+			if client.name == "dead" {
+				return errFake
+			}
+			return nil
+		})
+	}
+	if !pool.GetClientPool()[0].IsUnavailable() {
+		t.Fatalf("expected dead client to be open")
+	}
+
+	// 时钟未前进时不应被移除
+	time.Sleep(100 * time.Millisecond)
+	if len(pool.IDs()) != 2 {
+		t.Fatalf("expected no eviction before deadAfter, got %v", pool.IDs())
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case id := <-evicted:
+		if id != "dead" {
+			t.Fatalf("expected dead to be evicted, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected onEvict to be called")
+	}
+	if ids := pool.IDs(); len(ids) != 1 || ids[0] != "alive" {
+		t.Fatalf("expected only alive to remain, got %v", ids)
+	}
+}
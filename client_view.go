@@ -0,0 +1,44 @@
+package clientPool
+
+import (
+	"time"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// ClientView 是客户端在某一时刻的只读视图，所有字段都是值拷贝，
+// 供自定义负载均衡函数、监控面板等使用，不暴露可变的客户端包装
+type ClientView struct {
+	ID          string
+	Weight      int
+	Available   bool      // 当前能否被选中：未熔断（或冷却已结束）且未在排空
+	Unavailable bool      // 是否处于熔断中，与 Stats 相同，冷却已结束的客户端视为未熔断
+	FailCount   int       // 连续失败次数
+	LastFail    time.Time // 最后一次失败时间
+	Inflight    int       // 正在执行的请求数
+}
+
+// Clients 按加入顺序返回所有客户端的只读视图
+func (c *ClientPool[T]) Clients() []ClientView {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	views := make([]ClientView, 0, len(c.clients))
+	for _, cw := range c.clients {
+		views = append(views, c.viewOf(cw))
+	}
+	return views
+}
+
+// viewOf 生成客户端的只读视图，不修改客户端状态
+func (c *ClientPool[T]) viewOf(cw clientWrapper.ClientWrapped[T]) ClientView {
+	snap := cw.Snapshot()
+	return ClientView{
+		ID:          cw.GetClientId(),
+		Weight:      cw.GetWight(),
+		Available:   c.eligible(cw),
+		Unavailable: snap.Unavailable && !c.cooledDown(cw, snap),
+		FailCount:   snap.FailCount,
+		LastFail:    snap.LastFail,
+		Inflight:    cw.Inflight(),
+	}
+}
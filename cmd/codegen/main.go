@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/bighu630/clientPool"
 	"github.com/bighu630/clientPool/codegen"
 )
 
@@ -14,11 +15,18 @@ func main() {
 	var (
 		packagePath      = flag.String("package", "", "源接口或结构体的包路径 (必需)")
 		typeName         = flag.String("type", "", "源接口或结构体名称 (可选，从-client自动推断)")
+		typeNames        = flag.String("types", "", "多个源类型名称，逗号分隔，在同一文件中为每个类型生成 {Type}Pool (可选，设置后无需 -client)")
 		wrapperName      = flag.String("wrapper", "", "生成的包装器名称 (可选，自动生成)")
 		poolFieldName    = flag.String("pool", "pool", "客户端池字段名")
 		clientType       = flag.String("client", "", "客户端类型 (必需，如: *rpc.Client 或 codegen.It)")
 		outputPath       = flag.String("output", "", "输出文件路径 (可选，自动生成)")
 		enablePrometheus = flag.Bool("prometheus", true, "是否包含 Prometheus 监控")
+		errorlessMode    = flag.String("errorless", "", "不返回 error 的方法如何处理池错误: 空(忽略) / return(追加 error 返回值) / panic")
+		includeMethods   = flag.String("include", "", "只包装这些方法，逗号分隔 (可选)")
+		excludeMethods   = flag.String("exclude", "", "不包装这些方法，逗号分隔 (可选，设置 -include 时忽略)")
+		balancer         = flag.String("balancer", "", "固定使用的负载均衡策略，设置后构造函数不再接收 balancer 参数 (可选，如 round_robin)")
+		dryRun           = flag.Bool("dry-run", false, "只把生成的代码输出到标准输出，不写入文件")
+		baseContext      = flag.Bool("base-context", false, "不带 context 参数的方法使用包装器的基础 context（生成 SetBaseContext）")
 	)
 
 	flag.Usage = func() {
@@ -35,13 +43,18 @@ func main() {
 	flag.Parse()
 
 	// 验证必需参数
-	if *packagePath == "" || *clientType == "" {
+	types := splitList(*typeNames)
+	if *packagePath == "" || (*clientType == "" && len(types) == 0) {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// 从 clientType 中提取类型信息
+	// 从 clientType 中提取类型信息；多个源类型时包装器名称与客户端类型由生成器推断，
+	// 输出路径以第一个类型命名
 	extractedType := extractTypeName(*clientType)
+	if len(types) > 0 {
+		extractedType = types[0]
+	}
 
 	// 如果没有指定 typeName，使用提取的类型
 	if *typeName == "" {
@@ -61,18 +74,34 @@ func main() {
 
 	// 创建生成器配置
 	config := codegen.Config{
-		PackagePath:      *packagePath,
-		TypeName:         *typeName,
-		WrapperName:      *wrapperName,
-		PoolFieldName:    *poolFieldName,
-		ClientType:       *clientType,
-		OutputPath:       *outputPath,
-		EnablePrometheus: *enablePrometheus,
+		PackagePath:       *packagePath,
+		TypeName:          *typeName,
+		TypeNames:         types,
+		WrapperName:       *wrapperName,
+		PoolFieldName:     *poolFieldName,
+		ClientType:        *clientType,
+		OutputPath:        *outputPath,
+		EnablePrometheus:  *enablePrometheus,
+		BaseContext:       *baseContext,
+		ErrorlessMode:     codegen.ErrorlessMode(*errorlessMode),
+		IncludeMethods:    splitList(*includeMethods),
+		ExcludeMethods:    splitList(*excludeMethods),
+		DefaultBalancer:   clientPool.BalancerType(*balancer),
+		HideBalancerParam: *balancer != "",
 	}
 
 	// 创建生成器
 	gen := codegen.NewGenerator(config)
 
+	// 预览模式只输出代码，不写文件
+	if *dryRun {
+		if err := gen.GenerateTo(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 生成代码
 	fmt.Printf("正在生成包装代码...\n")
 	fmt.Printf("  源类型: %s.%s\n", config.PackagePath, config.TypeName)
@@ -89,6 +118,17 @@ func main() {
 	fmt.Printf("   文件路径: %s\n", absPath)
 }
 
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // extractTypeName 从客户端类型字符串中提取类型名称
 // 例如: "*rpc.Client" -> "Client", "codegen.It" -> "It", "*pkg.MyType" -> "MyType"
 func extractTypeName(clientType string) string {
@@ -1,14 +1,22 @@
 package codegen
 
 import (
+	"bytes"
 	"fmt"
 	"go/types"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/bighu630/clientPool"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
 )
 
 // Config 代码生成配置
@@ -17,20 +25,49 @@ type Config struct {
 	PackagePath string
 	// 源接口或结构体名称
 	TypeName string
-	// 生成的包装器名称
+	// 多个源类型名称（可选），设置后忽略 TypeName，在同一个文件中为每个类型生成一个包装器，
+	// 包装器名称为 {Type}Pool，客户端类型为接口本身或结构体指针
+	TypeNames []string
+	// 生成的包装器名称，只有一个源类型时生效
 	WrapperName string
 	// 客户端池字段名
 	PoolFieldName string
-	// 客户端类型（用于泛型）
+	// 客户端类型（用于泛型），只有一个源类型时生效
 	ClientType string
 	// 输出文件路径
 	OutputPath string
 	// 是否包含 Prometheus 监控
 	EnablePrometheus bool
-	// 自定义方法名转换函数（可选）
+	// 不带 context 参数的方法是否使用包装器的基础 context（生成 SetBaseContext 方法），
+	// 为 false 时使用 context.Background()
+	BaseContext bool
+	// 生成的构造函数固定使用的负载均衡策略，仅在 HideBalancerParam 为 true 时生效，为空时使用 RoundRobin，
+	// 只接受内置策略
+	DefaultBalancer clientPool.BalancerType
+	// 生成的构造函数不再接收 balancer 参数，而是固定使用 DefaultBalancer
+	HideBalancerParam bool
+	// 不返回 error 的方法如何处理池错误（如没有可用客户端），默认忽略
+	ErrorlessMode ErrorlessMode
+	// 只包装这些方法（可选），设置后忽略 ExcludeMethods
+	IncludeMethods []string
+	// 不包装这些方法（可选）
+	ExcludeMethods []string
+	// 自定义方法名到 Prometheus 方法标签的转换函数（可选），默认转换为蛇形命名
 	MethodNameTransform func(string) string
 }
 
+// ErrorlessMode 决定生成代码如何暴露不返回 error 的源方法上的池错误
+type ErrorlessMode string
+
+const (
+	// ErrorlessIgnore 忽略池错误，返回值保持零值（默认）
+	ErrorlessIgnore ErrorlessMode = ""
+	// ErrorlessReturn 为包装方法追加 err error 返回值
+	ErrorlessReturn ErrorlessMode = "return"
+	// ErrorlessPanic 池错误时 panic
+	ErrorlessPanic ErrorlessMode = "panic"
+)
+
 // MethodInfo 方法信息
 type MethodInfo struct {
 	Name            string
@@ -45,15 +82,24 @@ type MethodInfo struct {
 
 // ParamInfo 参数信息
 type ParamInfo struct {
-	Name string
-	Type string
+	Name     string
+	Type     string
+	Variadic bool // 是否为可变参数，此时 Type 形如 "...string"
+}
+
+// wrapperInfo 是一个源类型对应的包装器
+type wrapperInfo struct {
+	TypeName    string
+	WrapperName string
+	ClientType  string
+	Methods     []MethodInfo
 }
 
 // Generator 代码生成器
 type Generator struct {
-	config  Config
-	methods []MethodInfo
-	imports map[string]bool
+	config   Config
+	wrappers []wrapperInfo
+	imports  map[string]bool
 }
 
 // NewGenerator 创建新的代码生成器
@@ -64,25 +110,65 @@ func NewGenerator(config Config) *Generator {
 	}
 }
 
-// Generate 生成包装代码
+// Generate 生成包装代码并写入 OutputPath
 func (g *Generator) Generate() error {
+	// 先渲染再写入，生成失败时不会留下残缺文件
+	src, err := g.Render()
+	if err != nil {
+		return err
+	}
+	if err := g.writeFile(src); err != nil {
+		return fmt.Errorf("failed to generate code: %w", err)
+	}
+	return nil
+}
+
+// GenerateTo 生成包装代码并写入 w 而不是 OutputPath，不会创建任何文件（如预览）。
+// OutputPath 仍用于确定生成代码的包名
+func (g *Generator) GenerateTo(w io.Writer) error {
+	src, err := g.Render()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(src); err != nil {
+		return fmt.Errorf("failed to write generated code: %w", err)
+	}
+	return nil
+}
+
+// Render 校验配置、解析源类型并返回格式化后的生成代码，不做任何文件读写，
+// 便于嵌入其他工具。OutputPath 仍用于确定生成代码的包名
+func (g *Generator) Render() ([]byte, error) {
+	switch g.config.ErrorlessMode {
+	case ErrorlessIgnore, ErrorlessReturn, ErrorlessPanic:
+	default:
+		return nil, fmt.Errorf("unsupported errorless mode %q", g.config.ErrorlessMode)
+	}
+	if b := g.config.DefaultBalancer; b != "" && balancerExprs[b] == "" {
+		return nil, fmt.Errorf("unsupported balancer %q", b)
+	}
+
 	// 1. 解析源类型
 	if err := g.parseType(); err != nil {
-		return fmt.Errorf("failed to parse type: %w", err)
+		return nil, fmt.Errorf("failed to parse type: %w", err)
 	}
 
 	// 2. 生成代码
-	if err := g.generateCode(); err != nil {
-		return fmt.Errorf("failed to generate code: %w", err)
+	src, err := g.renderTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
 	}
-
-	return nil
+	return src, nil
 }
 
 // parseType 解析类型并提取方法
 func (g *Generator) parseType() error {
+	// 同一个生成器可以多次生成，每次重新收集
+	g.wrappers = nil
+	g.imports = make(map[string]bool)
+
 	cfg := &packages.Config{
-		Mode: packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedImports,
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps,
 	}
 
 	pkgs, err := packages.Load(cfg, g.config.PackagePath)
@@ -99,26 +185,60 @@ func (g *Generator) parseType() error {
 		return fmt.Errorf("package has errors: %v", pkg.Errors)
 	}
 
+	typeNames := g.config.TypeNames
+	if len(typeNames) == 0 {
+		typeNames = []string{g.config.TypeName}
+	}
+	for _, typeName := range typeNames {
+		w, err := g.parseWrapper(pkg, typeName, len(typeNames) == 1)
+		if err != nil {
+			return err
+		}
+		g.wrappers = append(g.wrappers, w)
+	}
+
+	return g.filterMethods()
+}
+
+// parseWrapper 解析一个源类型的方法，single 为 true 时使用配置中的包装器名称与客户端类型
+func (g *Generator) parseWrapper(pkg *packages.Package, typeName string, single bool) (wrapperInfo, error) {
+	w := wrapperInfo{
+		TypeName:    typeName,
+		WrapperName: typeName + "Pool",
+	}
+
 	// 查找类型
-	obj := pkg.Types.Scope().Lookup(g.config.TypeName)
+	obj := pkg.Types.Scope().Lookup(typeName)
 	if obj == nil {
-		return fmt.Errorf("type %s not found in package %s", g.config.TypeName, g.config.PackagePath)
+		return w, fmt.Errorf("type %s not found in package %s", typeName, g.config.PackagePath)
 	}
 
 	// 获取类型的方法集
 	var methodSet *types.MethodSet
 	switch t := obj.Type().(type) {
 	case *types.Named:
+		// 泛型类型的方法引用类型参数，生成的代码无法编译，直接报错
+		if t.TypeParams().Len() > 0 {
+			return w, fmt.Errorf("unsupported: generic type %s", typeName)
+		}
 		// 对于命名类型，检查底层是否为接口
 		if _, ok := t.Underlying().(*types.Interface); ok {
 			// 接口类型，直接使用类型本身
 			methodSet = types.NewMethodSet(t)
+			w.ClientType = g.qualifier(pkg) + typeName
 		} else {
 			// 结构体等类型，获取指针类型的方法集（包含值接收者和指针接收者的方法）
 			methodSet = types.NewMethodSet(types.NewPointer(t))
+			w.ClientType = "*" + g.qualifier(pkg) + typeName
 		}
 	default:
-		return fmt.Errorf("unsupported type: %T", t)
+		return w, fmt.Errorf("unsupported type: %T", t)
+	}
+	if single && g.config.WrapperName != "" {
+		w.WrapperName = g.config.WrapperName
+	}
+	if single && g.config.ClientType != "" {
+		w.ClientType = g.config.ClientType
 	}
 
 	// 提取所有公有方法
@@ -133,18 +253,63 @@ func (g *Generator) parseType() error {
 
 		methodInfo, err := g.parseMethod(method, pkg)
 		if err != nil {
-			return fmt.Errorf("failed to parse method %s: %w", method.Name(), err)
+			return w, fmt.Errorf("failed to parse method %s: %w", method.Name(), err)
 		}
 
-		g.methods = append(g.methods, methodInfo)
+		w.Methods = append(w.Methods, methodInfo)
 	}
 
+	return w, nil
+}
+
+// qualifier 返回源包在生成代码中的限定前缀，输出到源包所在的包时为空
+func (g *Generator) qualifier(pkg *packages.Package) string {
+	if filepath.Base(filepath.Dir(g.config.OutputPath)) == filepath.Base(g.config.PackagePath) {
+		return ""
+	}
+	return pkg.Name + "."
+}
+
+// filterMethods 按 IncludeMethods / ExcludeMethods 过滤方法（对所有源类型生效），
+// Include 中的方法在所有源类型中都不存在时报错
+func (g *Generator) filterMethods() error {
+	include := len(g.config.IncludeMethods) > 0
+	if include {
+		for _, name := range g.config.IncludeMethods {
+			found := slices.ContainsFunc(g.wrappers, func(w wrapperInfo) bool {
+				return slices.ContainsFunc(w.Methods, func(m MethodInfo) bool { return m.Name == name })
+			})
+			if !found {
+				return fmt.Errorf("method %s not found in %s", name, g.typeNamesString())
+			}
+		}
+	}
+	for i := range g.wrappers {
+		g.wrappers[i].Methods = slices.DeleteFunc(g.wrappers[i].Methods, func(m MethodInfo) bool {
+			if include {
+				return !slices.Contains(g.config.IncludeMethods, m.Name)
+			}
+			return slices.Contains(g.config.ExcludeMethods, m.Name)
+		})
+	}
 	return nil
 }
 
+// typeNamesString 返回源类型名称列表，用于错误信息
+func (g *Generator) typeNamesString() string {
+	names := make([]string, 0, len(g.wrappers))
+	for _, w := range g.wrappers {
+		names = append(names, w.TypeName)
+	}
+	return strings.Join(names, ", ")
+}
+
 // parseMethod 解析方法签名
 func (g *Generator) parseMethod(method *types.Func, pkg *packages.Package) (MethodInfo, error) {
 	sig := method.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return MethodInfo{}, fmt.Errorf("unsupported: generic method %s", method.Name())
+	}
 
 	info := MethodInfo{
 		Name:            method.Name(),
@@ -164,9 +329,16 @@ func (g *Generator) parseMethod(method *types.Func, pkg *packages.Package) (Meth
 			paramName = fmt.Sprintf("arg%d", i)
 		}
 
+		// 可变参数在签名中的类型是切片，声明时需要还原为 ...Elem
+		variadic := sig.Variadic() && i == params.Len()-1
+		if variadic {
+			paramType = "..." + g.typeString(param.Type().(*types.Slice).Elem(), pkg)
+		}
+
 		info.Params = append(info.Params, ParamInfo{
-			Name: paramName,
-			Type: paramType,
+			Name:     paramName,
+			Type:     paramType,
+			Variadic: variadic,
 		})
 
 		// 检查是否有 context.Context 参数
@@ -237,49 +409,59 @@ func (g *Generator) collectImports(t types.Type, pkg *packages.Package) {
 	}
 }
 
-// generateCode 生成包装代码
-func (g *Generator) generateCode() error {
+// writeFile 把生成的代码写入 OutputPath，必要时创建目录
+func (g *Generator) writeFile(src []byte) error {
 	// 确保输出目录存在
 	outputDir := filepath.Dir(g.config.OutputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// 创建输出文件
-	f, err := os.Create(g.config.OutputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	if err := os.WriteFile(g.config.OutputPath, src, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
-	defer f.Close()
 
+	return nil
+}
+
+// renderTemplate 执行模板并用 goimports 规则格式化生成的代码
+func (g *Generator) renderTemplate() ([]byte, error) {
 	// 准备模板数据
 	data := struct {
 		PackageName      string
 		Imports          []string
-		WrapperName      string
 		PoolFieldName    string
-		ClientType       string
 		SourcePackage    string
-		Methods          []MethodInfo
+		Wrappers         []wrapperInfo
 		EnablePrometheus bool
+		BaseContext      bool
+		ErrorlessMode    ErrorlessMode
+		HideBalancer     bool
+		Balancer         string
 	}{
 		PackageName:      filepath.Base(filepath.Dir(g.config.OutputPath)),
 		Imports:          g.getImportList(),
-		WrapperName:      g.config.WrapperName,
 		PoolFieldName:    g.config.PoolFieldName,
-		ClientType:       g.config.ClientType,
 		SourcePackage:    g.config.PackagePath,
-		Methods:          g.methods,
+		Wrappers:         g.wrappers,
 		EnablePrometheus: g.config.EnablePrometheus,
+		BaseContext:      g.config.BaseContext,
+		ErrorlessMode:    g.config.ErrorlessMode,
+		HideBalancer:     g.config.HideBalancerParam,
+		Balancer:         balancerExpr(g.config.DefaultBalancer),
 	}
 
 	// 执行模板
 	tmpl := template.Must(template.New("wrapper").Funcs(template.FuncMap{
 		"join":               strings.Join,
 		"lower":              strings.ToLower,
-		"toSnakeCase":        toSnakeCase,
+		"methodLabel":        g.methodLabel,
+		"labelsVar":          func(wrapperName string) string { return lowerFirst(wrapperName) + "MethodLabels" },
 		"paramList":          g.paramList,
 		"paramNames":         g.paramNames,
+		"callArgs":           g.callArgs,
+		"ctxExpr":            g.ctxExpr,
+		"wrapperResults":     g.wrapperResults,
 		"resultList":         g.resultList,
 		"resultNames":        g.resultNames,
 		"nonErrorResults":    g.nonErrorResults,
@@ -287,11 +469,17 @@ func (g *Generator) generateCode() error {
 		"hasMultipleReturns": func(m MethodInfo) bool { return len(m.Results) > 1 },
 	}).Parse(wrapperTemplate))
 
-	if err := tmpl.Execute(f, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	return nil
+	// 排序导入并 gofmt，保证生成文件能通过 gofmt -l 检查
+	src, err := imports.Process(g.config.OutputPath, buf.Bytes(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, buf.String())
+	}
+	return src, nil
 }
 
 // getImportList 获取导入列表
@@ -314,17 +502,19 @@ func (g *Generator) getImportList() []string {
 		}
 	}
 
-	// 添加从类型分析中收集的导入
+	// 添加从类型分析中收集的导入，排序保证输出稳定
+	var collected []string
 	for imp := range g.imports {
-		if imp != "" && imp != "context" &&
+		if imp != "" && imp != "context" && imp != "time" &&
 			imp != "github.com/bighu630/clientPool" &&
 			imp != "github.com/bighu630/clientPool/middleware" &&
 			imp != g.config.PackagePath {
-			imports = append(imports, imp)
+			collected = append(collected, imp)
 		}
 	}
+	sort.Strings(collected)
 
-	return imports
+	return append(imports, collected...)
 }
 
 // paramList 生成参数列表
@@ -336,15 +526,49 @@ func (g *Generator) paramList(params []ParamInfo) string {
 	return strings.Join(parts, ", ")
 }
 
-// paramNames 生成参数名列表
+// paramNames 生成参数名列表，可变参数以 name... 展开
 func (g *Generator) paramNames(params []ParamInfo) string {
 	var parts []string
 	for _, p := range params {
+		if p.Variadic {
+			parts = append(parts, p.Name+"...")
+			continue
+		}
 		parts = append(parts, p.Name)
 	}
 	return strings.Join(parts, ", ")
 }
 
+// callArgs 生成调用客户端方法的实参列表，context 参数替换为闭包中经过中间件的 ctx
+func (g *Generator) callArgs(m MethodInfo) string {
+	params := slices.Clone(m.Params)
+	if m.HasContext {
+		params[m.ContextParamIdx].Name = "ctx"
+	}
+	return g.paramNames(params)
+}
+
+// ctxExpr 返回方法的请求 context 表达式：带 context 参数时为该参数，
+// 否则为包装器的基础 context 或 context.Background()
+func (g *Generator) ctxExpr(m MethodInfo) string {
+	switch {
+	case m.HasContext:
+		return m.Params[m.ContextParamIdx].Name
+	case g.config.BaseContext:
+		return m.ReceiverName + ".baseContext()"
+	default:
+		return "context.Background()"
+	}
+}
+
+// wrapperResults 返回包装方法的返回值，ErrorlessReturn 模式下为不返回 error 的方法追加 err
+func (g *Generator) wrapperResults(m MethodInfo) []ParamInfo {
+	if m.HasError || g.config.ErrorlessMode != ErrorlessReturn {
+		return m.Results
+	}
+	return append(slices.Clone(m.Results), ParamInfo{Name: "err", Type: "error"})
+}
+
 // resultList 生成返回值列表（带名称）
 func (g *Generator) resultList(results []ParamInfo) string {
 	if len(results) == 0 {
@@ -385,6 +609,43 @@ func (g *Generator) getErrorResultName(m MethodInfo) string {
 	return ""
 }
 
+// balancerExprs 是内置负载均衡策略在生成代码中的常量名
+var balancerExprs = map[clientPool.BalancerType]string{
+	clientPool.RoundRobin:               "clientPool.RoundRobin",
+	clientPool.WeightedRandom:           "clientPool.WeightedRandom",
+	clientPool.Random:                   "clientPool.Random",
+	clientPool.SmoothWeightedRoundRobin: "clientPool.SmoothWeightedRoundRobin",
+	clientPool.ConsistentHash:           "clientPool.ConsistentHash",
+	clientPool.WeightedLeastConnections: "clientPool.WeightedLeastConnections",
+	clientPool.CustomBalancer:           "clientPool.CustomBalancer",
+}
+
+// balancerExpr 返回负载均衡策略在生成代码中的表达式，为空时使用 RoundRobin。
+// b 已在 Render 中校验过
+func balancerExpr(b clientPool.BalancerType) string {
+	if b == "" {
+		b = clientPool.RoundRobin
+	}
+	return balancerExprs[b]
+}
+
+// methodLabel 返回方法的 Prometheus 方法标签，优先使用 MethodNameTransform
+func (g *Generator) methodLabel(name string) string {
+	if g.config.MethodNameTransform != nil {
+		return g.config.MethodNameTransform(name)
+	}
+	return toSnakeCase(name)
+}
+
+// lowerFirst 把首字母转为小写，用于生成不导出的标识符
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
 // toSnakeCase 转换为蛇形命名
 func toSnakeCase(s string) string {
 	var result []rune
@@ -406,40 +667,63 @@ import (
 {{end}}
 )
 
-// MultiSt wraps multiple clients with load balancing and middleware support
-type {{.WrapperName}} struct {
-	{{.PoolFieldName}} *clientPool.ClientPool[{{.ClientType}}]
+{{range .Wrappers}}{{$w := .}}// {{$w.WrapperName}} wraps multiple clients with load balancing and middleware support
+type {{$w.WrapperName}} struct {
+	{{$.PoolFieldName}} *clientPool.ClientPool[{{$w.ClientType}}]{{if $.BaseContext}}
+	baseCtx context.Context{{end}}
 }
 
-// New{{.WrapperName}} creates a new {{.WrapperName}} instance
-func New{{.WrapperName}}(maxFails int, cooldown time.Duration, balancer clientPool.BalancerType) *{{.WrapperName}} {
-	return &{{.WrapperName}}{
-		{{.PoolFieldName}}: clientPool.NewClientPool[{{.ClientType}}](maxFails, cooldown, balancer),
+// New{{$w.WrapperName}} creates a new {{$w.WrapperName}} instance{{if $.HideBalancer}} using {{$.Balancer}}{{end}}
+func New{{$w.WrapperName}}(maxFails int, cooldown time.Duration{{if not $.HideBalancer}}, balancer clientPool.BalancerType{{end}}) *{{$w.WrapperName}} {
+	return &{{$w.WrapperName}}{
+		{{$.PoolFieldName}}: clientPool.NewClientPool[{{$w.ClientType}}](maxFails, cooldown, {{if $.HideBalancer}}{{$.Balancer}}{{else}}balancer{{end}}),
 	}
 }
 
 // AddClient adds a client to the pool with a name and weight
-func (m *{{.WrapperName}}) AddClient(client {{.ClientType}}, name string, weight int) {
-	m.{{.PoolFieldName}}.AddClient(client, name, weight)
+func (m *{{$w.WrapperName}}) AddClient(client {{$w.ClientType}}, name string, weight int) {
+	m.{{$.PoolFieldName}}.AddClient(client, name, weight)
 }
 
 // RegisterMiddleware registers a middleware to the pool
-func (m *{{.WrapperName}}) RegisterMiddleware(mw middleware.Middleware[{{.ClientType}}]) {
-	m.{{.PoolFieldName}}.RegisterMiddleware(mw)
+func (m *{{$w.WrapperName}}) RegisterMiddleware(mw middleware.Middleware[{{$w.ClientType}}]) {
+	m.{{$.PoolFieldName}}.RegisterMiddleware(mw)
+}
+{{if $.BaseContext}}
+// SetBaseContext sets the context used by methods without a context parameter; call it before use
+func (m *{{$w.WrapperName}}) SetBaseContext(ctx context.Context) {
+	m.baseCtx = ctx
 }
 
-{{range .Methods}}
+// baseContext returns the base context, defaulting to context.Background()
+func (m *{{$w.WrapperName}}) baseContext() context.Context {
+	if m.baseCtx != nil {
+		return m.baseCtx
+	}
+	return context.Background()
+}
+{{end}}
+{{if and $.EnablePrometheus $w.Methods}}
+// {{labelsVar $w.WrapperName}} maps each wrapped method to its Prometheus method label
+var {{labelsVar $w.WrapperName}} = map[string]string{
+{{range $w.Methods}}	"{{.Name}}": {{printf "%q" (methodLabel .Name)}},
+{{end}}}
+{{end}}
+{{range $w.Methods}}{{$ctx := ctxExpr .}}
 // {{.Name}} wraps the client method with pool management and monitoring
-func ({{.ReceiverName}} *{{$.WrapperName}}) {{.Name}}({{paramList .Params}}){{if .Results}} {{resultList .Results}}{{end}} {
-{{if $.EnablePrometheus}}	{{if .HasContext}}ctx = context.WithValue(ctx, middleware.PrometheusMethodKey{}, "{{toSnakeCase .Name}}"){{else}}ctx := context.WithValue(context.Background(), middleware.PrometheusMethodKey{}, "{{toSnakeCase .Name}}"){{end}}
-{{end}}	{{if .HasError}}{{getErrorResultName .}} = {{.ReceiverName}}.{{$.PoolFieldName}}.Do({{if .HasContext}}ctx{{else}}ctx{{end}}, func(ctx context.Context, client {{$.ClientType}}) error {
-		{{$nonErr := nonErrorResults .}}{{if $nonErr}}{{$nonErr}}, {{end}}{{getErrorResultName .}} = client.{{.Name}}({{paramNames .Params}})
+func ({{.ReceiverName}} *{{$w.WrapperName}}) {{.Name}}({{paramList .Params}}){{with wrapperResults .}} {{resultList .}}{{end}} {
+{{if $.EnablePrometheus}}	ctx {{if ne $ctx "ctx"}}:{{end}}= context.WithValue({{$ctx}}, middleware.PrometheusMethodKey{}, {{labelsVar $w.WrapperName}}["{{.Name}}"])
+{{else if ne $ctx "ctx"}}	ctx := {{$ctx}}
+{{end}}	{{if .HasError}}{{getErrorResultName .}} = {{.ReceiverName}}.{{$.PoolFieldName}}.Do(ctx, func(ctx context.Context, client {{$w.ClientType}}) error {
+		{{$nonErr := nonErrorResults .}}{{if $nonErr}}{{$nonErr}}, {{end}}{{getErrorResultName .}} = client.{{.Name}}({{callArgs .}})
 		return {{getErrorResultName .}}
-	}){{else}}{{.ReceiverName}}.{{$.PoolFieldName}}.Do({{if .HasContext}}ctx{{else}}ctx{{end}}, func(ctx context.Context, client {{$.ClientType}}) error {
-		{{if .Results}}{{resultNames .Results}} = {{end}}client.{{.Name}}({{paramNames .Params}})
+	}){{else}}{{if eq $.ErrorlessMode "return"}}err = {{else if eq $.ErrorlessMode "panic"}}if err := {{end}}{{.ReceiverName}}.{{$.PoolFieldName}}.Do(ctx, func(ctx context.Context, client {{$w.ClientType}}) error {
+		{{if .Results}}{{resultNames .Results}} = {{end}}client.{{.Name}}({{callArgs .}})
 		return nil
-	}){{end}}
+	}){{if eq $.ErrorlessMode "panic"}}; err != nil {
+		panic(err)
+	}{{end}}{{end}}
 	return
 }
 {{end}}
-`
+{{end}}`
@@ -0,0 +1,478 @@
+package codegen
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bighu630/clientPool"
+)
+
+const testPackagePath = "github.com/bighu630/clientPool/codegen"
+
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden 对比生成结果与 testdata 下的 golden 文件，-update 时重写 golden 文件
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("generated code differs from %s (run go test -update to refresh):\n%s", path, got)
+	}
+}
+
+// generateAndBuild 在模块内的临时目录生成包装代码并编译，返回生成的源码
+func generateAndBuild(t *testing.T, config Config) string {
+	t.Helper()
+	dir, err := os.MkdirTemp(".", "_gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	config.OutputPath = filepath.Join(dir, "wrapper", "client.go")
+	if err := NewGenerator(config).Generate(); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	src, err := os.ReadFile(config.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "./"+filepath.ToSlash(filepath.Dir(config.OutputPath)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated code does not compile: %v\n%s\n%s", err, out, src)
+	}
+	return string(src)
+}
+
+func TestGenerate_Variadic(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		EnablePrometheus: true,
+	})
+	if !strings.Contains(src, "InterfaceTest7(ctx context.Context, format string, args ...any)") {
+		t.Errorf("variadic parameter not declared with ...:\n%s", src)
+	}
+	if !strings.Contains(src, "client.InterfaceTest7(ctx, format, args...)") {
+		t.Errorf("variadic argument not spread at call site:\n%s", src)
+	}
+}
+
+func TestGenerate_GoldenInterface(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		EnablePrometheus: true,
+	})
+	assertGolden(t, "it_pool.golden", src)
+	// It 嵌入的 It2 的方法同样被包装
+	for _, name := range []string{"InterfaceTestA", "InterfaceTestB"} {
+		if !strings.Contains(src, "func (m *ItPool) "+name+"(") {
+			t.Errorf("embedded method %s not generated", name)
+		}
+	}
+}
+
+// 未指定 ClientType 时由源类型推导：结构体使用指针，接口不加 *
+func TestGenerate_GoldenDerivedClientType(t *testing.T) {
+	cases := []struct {
+		typeName, wrapperName, clientType, golden string
+	}{
+		{"St", "StPool", "*codegen.St", "st_pool.golden"},
+		{"It", "ItPool", "codegen.It", "it_pool.golden"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.typeName, func(t *testing.T) {
+			src := generateAndBuild(t, Config{
+				PackagePath:      testPackagePath,
+				TypeName:         tc.typeName,
+				WrapperName:      tc.wrapperName,
+				PoolFieldName:    "pool",
+				EnablePrometheus: true,
+			})
+			if !strings.Contains(src, "func(ctx context.Context, client "+tc.clientType+") error") {
+				t.Errorf("expected client type %s in Do callbacks:\n%s", tc.clientType, src)
+			}
+			assertGolden(t, tc.golden, src)
+		})
+	}
+}
+
+func TestGenerate_Gofmt(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		EnablePrometheus: true,
+	})
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != src {
+		t.Errorf("generated code is not gofmt clean:\n%s", src)
+	}
+}
+
+func TestGenerate_ContextlessWithoutPrometheus(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:   testPackagePath,
+		TypeName:      "It",
+		WrapperName:   "ItPool",
+		PoolFieldName: "pool",
+		ClientType:    "codegen.It",
+	})
+	if !strings.Contains(src, "ctx := context.Background()") {
+		t.Errorf("context-less method should synthesize a background context:\n%s", src)
+	}
+	// 参数名不是 ctx 的 context 也要经过中间件传给客户端
+	if !strings.Contains(src, "ctx := c\n") || !strings.Contains(src, "client.InterfaceTest8(ctx, id)") {
+		t.Errorf("context parameter not threaded through the pool:\n%s", src)
+	}
+}
+
+func TestGenerate_BaseContext(t *testing.T) {
+	for _, prometheus := range []bool{false, true} {
+		src := generateAndBuild(t, Config{
+			PackagePath:      testPackagePath,
+			TypeName:         "It",
+			WrapperName:      "ItPool",
+			PoolFieldName:    "pool",
+			ClientType:       "codegen.It",
+			EnablePrometheus: prometheus,
+			BaseContext:      true,
+		})
+		if !strings.Contains(src, "func (m *ItPool) SetBaseContext(ctx context.Context)") {
+			t.Errorf("prometheus=%v: SetBaseContext not generated:\n%s", prometheus, src)
+		}
+		if !strings.Contains(src, "m.baseContext()") || strings.Contains(src, "context.Background(), middleware") {
+			t.Errorf("prometheus=%v: context-less methods should use the base context:\n%s", prometheus, src)
+		}
+	}
+}
+
+func TestGenerate_ErrorlessMode(t *testing.T) {
+	tests := []struct {
+		mode ErrorlessMode
+		want []string
+	}{
+		{ErrorlessIgnore, []string{
+			"InterfaceTest2() (ret0 string, ret1 int) {",
+			"\tm.pool.Do(ctx,",
+		}},
+		{ErrorlessReturn, []string{
+			"InterfaceTest2() (ret0 string, ret1 int, err error) {",
+			"InterfaceTest4() (err error) {",
+			"err = m.pool.Do(ctx,",
+			// 本身返回 error 的方法不受影响
+			"InterfaceTest5() (ret0 error) {",
+		}},
+		{ErrorlessPanic, []string{
+			"InterfaceTest2() (ret0 string, ret1 int) {",
+			"if err := m.pool.Do(ctx,",
+			"panic(err)",
+		}},
+	}
+	for _, tt := range tests {
+		src := generateAndBuild(t, Config{
+			PackagePath:      testPackagePath,
+			TypeName:         "It",
+			WrapperName:      "ItPool",
+			PoolFieldName:    "pool",
+			ClientType:       "codegen.It",
+			EnablePrometheus: true,
+			ErrorlessMode:    tt.mode,
+		})
+		for _, want := range tt.want {
+			if !strings.Contains(src, want) {
+				t.Errorf("mode %q: missing %q in:\n%s", tt.mode, want, src)
+			}
+		}
+	}
+
+	err := NewGenerator(Config{PackagePath: testPackagePath, TypeName: "It", ErrorlessMode: "log"}).Generate()
+	if err == nil || !strings.Contains(err.Error(), "unsupported errorless mode") {
+		t.Fatalf("expected unsupported mode error, got %v", err)
+	}
+}
+
+func TestGenerate_UnknownBalancer(t *testing.T) {
+	_, err := NewGenerator(Config{
+		PackagePath:       testPackagePath,
+		TypeName:          "It",
+		DefaultBalancer:   "round_robbin",
+		HideBalancerParam: true,
+	}).Render()
+	if err == nil || !strings.Contains(err.Error(), `unsupported balancer "round_robbin"`) {
+		t.Fatalf("expected unsupported balancer error, got %v", err)
+	}
+}
+
+func TestGenerate_GenericUnsupported(t *testing.T) {
+	for _, typeName := range []string{"GenIt", "GenSt"} {
+		dir := t.TempDir()
+		err := NewGenerator(Config{
+			PackagePath:   testPackagePath,
+			TypeName:      typeName,
+			WrapperName:   typeName + "Pool",
+			PoolFieldName: "pool",
+			ClientType:    "codegen." + typeName,
+			OutputPath:    filepath.Join(dir, "wrapper", "client.go"),
+		}).Generate()
+		if err == nil || !strings.Contains(err.Error(), "unsupported: generic") {
+			t.Fatalf("%s: expected explicit generic error, got %v", typeName, err)
+		}
+		if _, statErr := os.Stat(filepath.Join(dir, "wrapper", "client.go")); !os.IsNotExist(statErr) {
+			t.Fatalf("%s: no file should be written on error", typeName)
+		}
+	}
+}
+
+func TestGenerate_FilterMethods(t *testing.T) {
+	config := Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		EnablePrometheus: true,
+	}
+
+	include := config
+	include.IncludeMethods = []string{"InterfaceTest1", "InterfaceTest6"}
+	// Include 优先于 Exclude
+	include.ExcludeMethods = []string{"InterfaceTest1"}
+	src := generateAndBuild(t, include)
+	if n := strings.Count(src, "wraps the client method"); n != 2 {
+		t.Errorf("expected 2 wrapped methods, got %d:\n%s", n, src)
+	}
+	for _, name := range include.IncludeMethods {
+		if !strings.Contains(src, ") "+name+"(") {
+			t.Errorf("method %s not generated:\n%s", name, src)
+		}
+	}
+
+	exclude := config
+	exclude.ExcludeMethods = []string{"InterfaceTest1"}
+	src = generateAndBuild(t, exclude)
+	if strings.Contains(src, ") InterfaceTest1(") || !strings.Contains(src, ") InterfaceTest2(") {
+		t.Errorf("exclude filter not applied:\n%s", src)
+	}
+
+	missing := config
+	missing.IncludeMethods = []string{"NoSuchMethod"}
+	if err := NewGenerator(missing).Generate(); err == nil || !strings.Contains(err.Error(), "NoSuchMethod") {
+		t.Fatalf("expected error for unknown included method, got %v", err)
+	}
+}
+
+func TestGenerate_GoldenFixedBalancer(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:       testPackagePath,
+		TypeName:          "It",
+		WrapperName:       "ItPool",
+		PoolFieldName:     "pool",
+		ClientType:        "codegen.It",
+		EnablePrometheus:  true,
+		IncludeMethods:    []string{"InterfaceTest6"},
+		DefaultBalancer:   clientPool.SmoothWeightedRoundRobin,
+		HideBalancerParam: true,
+	})
+	assertGolden(t, "it_pool_fixed_balancer.golden", src)
+}
+
+func TestGenerate_MethodLabels(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:         testPackagePath,
+		TypeName:            "It",
+		WrapperName:         "ItPool",
+		PoolFieldName:       "pool",
+		ClientType:          "codegen.It",
+		EnablePrometheus:    true,
+		IncludeMethods:      []string{"InterfaceTest1", "InterfaceTestA"},
+		MethodNameTransform: func(name string) string { return "it." + name },
+	})
+	for _, want := range []string{
+		`"InterfaceTest1": "it.InterfaceTest1",`,
+		`"InterfaceTestA": "it.InterfaceTestA",`,
+		`middleware.PrometheusMethodKey{}, itPoolMethodLabels["InterfaceTestA"])`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %s in:\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerate_MethodNameTransform(t *testing.T) {
+	for _, tt := range []struct {
+		transform func(string) string
+		want      string
+	}{
+		{strings.ToUpper, `"InterfaceTest6": "INTERFACETEST6",`},
+		{nil, `"InterfaceTest6": "interface_test6",`}, // 默认蛇形命名
+	} {
+		g := NewGenerator(Config{
+			PackagePath:         testPackagePath,
+			TypeName:            "It",
+			WrapperName:         "ItPool",
+			PoolFieldName:       "pool",
+			ClientType:          "codegen.It",
+			OutputPath:          filepath.Join("wrapper", "client.go"),
+			EnablePrometheus:    true,
+			IncludeMethods:      []string{"InterfaceTest6"},
+			MethodNameTransform: tt.transform,
+		})
+		src, err := g.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(src), tt.want) {
+			t.Errorf("missing %s in:\n%s", tt.want, src)
+		}
+	}
+}
+
+func TestGenerate_MultipleTypes(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:      testPackagePath,
+		TypeNames:        []string{"It", "St"},
+		PoolFieldName:    "pool",
+		EnablePrometheus: true,
+	})
+	for _, want := range []string{
+		"type ItPool struct",
+		"pool *clientPool.ClientPool[codegen.It]",
+		"type StPool struct",
+		"pool *clientPool.ClientPool[*codegen.St]",
+		"func (m *ItPool) InterfaceTest1(",
+		"func (m *StPool) StructTest1(",
+		"var itPoolMethodLabels = map[string]string{",
+		"var stPoolMethodLabels = map[string]string{",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+	if n := strings.Count(src, `"github.com/bighu630/clientPool/codegen"`); n != 1 {
+		t.Errorf("expected the source package to be imported once, got %d", n)
+	}
+}
+
+func TestGenerateTo_MatchesGenerate(t *testing.T) {
+	config := Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		OutputPath:       filepath.Join(t.TempDir(), "wrapper", "client.go"),
+		EnablePrometheus: true,
+	}
+	g := NewGenerator(config)
+	var buf bytes.Buffer
+	if err := g.GenerateTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(config.OutputPath); !os.IsNotExist(err) {
+		t.Fatal("GenerateTo should not write the output file")
+	}
+	// 同一个生成器再次生成，结果不应重复
+	if err := g.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(config.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), written) {
+		t.Errorf("GenerateTo output differs from the written file:\n%s\n---\n%s", buf.Bytes(), written)
+	}
+
+	// 解析错误同样会返回
+	bad := config
+	bad.TypeName = "NoSuchType"
+	if err := NewGenerator(bad).GenerateTo(io.Discard); err == nil || !strings.Contains(err.Error(), "NoSuchType") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestRender_ParsesAsGo(t *testing.T) {
+	src, err := NewGenerator(Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "It",
+		WrapperName:      "ItPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.It",
+		OutputPath:       filepath.Join("wrapper", "client.go"),
+		EnablePrometheus: true,
+	}).Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "client.go", src, 0)
+	if err != nil {
+		t.Fatalf("rendered code is not valid Go: %v\n%s", err, src)
+	}
+	if file.Name.Name != "wrapper" {
+		t.Errorf("expected package wrapper, got %s", file.Name.Name)
+	}
+	var methods int
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && strings.HasPrefix(fn.Name.Name, "InterfaceTest") {
+			methods++
+		}
+	}
+	if methods != 10 {
+		t.Errorf("expected 10 wrapped methods, got %d", methods)
+	}
+}
+
+func TestGenerate_EmbeddedInterfaces(t *testing.T) {
+	src := generateAndBuild(t, Config{
+		PackagePath:      testPackagePath,
+		TypeName:         "ItEmbed",
+		WrapperName:      "ItEmbedPool",
+		PoolFieldName:    "pool",
+		ClientType:       "codegen.ItEmbed",
+		EnablePrometheus: true,
+	})
+	for _, want := range []string{
+		"func (m *ItEmbedPool) InterfaceTestA() (ret0 error)",
+		"func (m *ItEmbedPool) InterfaceTestB(x int) (ret0 int, ret1 error)",
+		"func (m *ItEmbedPool) ReadFrom(r io.Reader) (n int64, err error)",
+		`"io"`, // 嵌入接口所在包引用的类型也要导入
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+}
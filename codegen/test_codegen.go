@@ -1,6 +1,9 @@
 package codegen
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 type It interface {
 	InterfaceTest1(a int, b string) error
@@ -9,6 +12,8 @@ type It interface {
 	InterfaceTest4()
 	InterfaceTest5() error
 	InterfaceTest6(ctx context.Context, key string) (string, error)
+	InterfaceTest7(ctx context.Context, format string, args ...any) error
+	InterfaceTest8(c context.Context, id int) (int, error)
 	It2
 }
 
@@ -17,6 +22,12 @@ type It2 interface {
 	InterfaceTestB(x int) (int, error)
 }
 
+// ItEmbed 嵌入了本包与其他包的接口，方法需要被递归包装
+type ItEmbed interface {
+	It2
+	io.ReaderFrom
+}
+
 type St struct {
 	id int
 	n  string
@@ -46,3 +57,16 @@ func (s St) StructTest5() error {
 func (s St) StructTest6(x any, y []any, z [][]string) error {
 	return nil
 }
+
+// 泛型类型，代码生成不支持
+type GenIt[T any] interface {
+	Get(ctx context.Context) (T, error)
+}
+
+type GenSt[T any] struct {
+	v T
+}
+
+func (s *GenSt[T]) Get(ctx context.Context) (T, error) {
+	return s.v, nil
+}
@@ -24,7 +24,7 @@ func main() {
 		TypeName:         "RPCClient",
 		WrapperName:      "MultiRPCClient",
 		PoolFieldName:    "rpcPool",
-		ClientType:       "*RPCClient",
+		ClientType:       "RPCClient",
 		OutputPath:       "./generated/multi_rpc_client_generated.go",
 		EnablePrometheus: true,
 	}
@@ -43,54 +43,45 @@ func main() {
 	}
 
 	fmt.Println("\n✅ 代码生成成功!")
-	fmt.Println("\n生成的代码示例：")
+	fmt.Println("\n生成的文件已包含包装器结构体、构造函数以及每个方法的包装，例如：")
 	fmt.Println("--------------------")
-	fmt.Println(`
-// GetSlot wraps the client method with pool management and monitoring
-func (m *MultiRPCClient) GetSlot(ctx context.Context, commitment string) (slot uint64, err error) {
-	ctx = context.WithValue(ctx, middleware.PrometheusMethodKey{}, "get_slot")
-	err = m.rpcPool.Do(ctx, func(ctx context.Context, client *RPCClient) error {
-		slot, err = client.GetSlot(ctx, commitment)
-		return err
-	})
-	return
+	fmt.Print(`
+// MultiRPCClient wraps multiple clients with load balancing and middleware support
+type MultiRPCClient struct {
+	rpcPool *clientPool.ClientPool[RPCClient]
 }
-`)
-	fmt.Println("--------------------")
-
-	fmt.Println("\n接下来，你需要手动创建包装器结构体：")
-	fmt.Println("--------------------")
-	fmt.Println(`
-package generated
 
-import (
-	clientpool "github.com/bighu630/clientPool"
-)
+// NewMultiRPCClient creates a new MultiRPCClient instance
+func NewMultiRPCClient(maxFails int, cooldown time.Duration, balancer clientPool.BalancerType) *MultiRPCClient
 
-type MultiRPCClient struct {
-	rpcPool *clientpool.ClientPool[*RPCClient]
+// multiRPCClientMethodLabels maps each wrapped method to its Prometheus method label
+var multiRPCClientMethodLabels = map[string]string{
+	"GetBalance":      "get_balance",
+	"GetBlockHeight":  "get_block_height",
+	"GetSlot":         "get_slot",
+	"SendTransaction": "send_transaction",
 }
 
-func NewMultiRPCClient(pool *clientpool.ClientPool[*RPCClient]) *MultiRPCClient {
-	return &MultiRPCClient{
-		rpcPool: pool,
-	}
+// GetSlot wraps the client method with pool management and monitoring
+func (m *MultiRPCClient) GetSlot(ctx context.Context, commitment string) (ret0 uint64, ret1 error) {
+	ctx = context.WithValue(ctx, middleware.PrometheusMethodKey{}, multiRPCClientMethodLabels["GetSlot"])
+	ret1 = m.rpcPool.Do(ctx, func(ctx context.Context, client RPCClient) error {
+		ret0, ret1 = client.GetSlot(ctx, commitment)
+		return ret1
+	})
+	return
 }
 `)
 	fmt.Println("--------------------")
 
-	fmt.Println("\n然后就可以使用了：")
+	fmt.Println("\n直接使用生成的包装器：")
 	fmt.Println("--------------------")
-	fmt.Println(`
-pool := clientpool.NewClientPool[*RPCClient](3, 5*time.Second, clientpool.RoundRobin)
-pool.RegisterMiddleware(middleware.PrometheusMiddleware[*RPCClient]())
-
-client1 := &mockRPCClient{name: "client1"}
-client2 := &mockRPCClient{name: "client2"}
-pool.AddClient(client1, 1)
-pool.AddClient(client2, 1)
+	fmt.Print(`
+multiClient := generated.NewMultiRPCClient(3, 5*time.Second, clientPool.RoundRobin)
+multiClient.RegisterMiddleware(middleware.NewPrometheusMiddleware[RPCClient]())
+multiClient.AddClient(&mockRPCClient{name: "client1"}, "client1", 1)
+multiClient.AddClient(&mockRPCClient{name: "client2"}, "client2", 1)
 
-multiClient := generated.NewMultiRPCClient(pool)
 slot, err := multiClient.GetSlot(context.Background(), "finalized")
 `)
 	fmt.Println("--------------------")
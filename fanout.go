@@ -0,0 +1,68 @@
+package clientPool
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// DoN 用默认负载均衡策略选出 n 个不同的可用客户端并发执行 fn，第一个成功即返回 nil 并取消其余请求，
+// 被取消的请求不计入熔断失败。可用客户端不足 n 个时只在已选出的客户端上执行，一个都没有时返回
+// NoAvailableClientError；全部失败时返回所有错误的聚合（errors.Join）。
+// fn 会被并发调用，且 DoN 返回时被取消的 fn 可能仍在执行，fn 写入外部变量时需自行同步
+func (c *ClientPool[T]) DoN(ctx context.Context, n int, fn func(ctx context.Context, client T) error) error {
+	if fn == nil {
+		return ErrNilFunc
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.enter(); err != nil {
+		return err
+	}
+
+	tried := make(map[clientWrapper.ClientWrapped[T]]bool, n)
+	selected := make([]clientWrapper.ClientWrapped[T], 0, n)
+	for len(selected) < max(n, 1) {
+		cw, err := c.pick(ctx, c.defaultBalancer, tried)
+		if err != nil {
+			break
+		}
+		tried[cw] = true
+		selected = append(selected, cw)
+	}
+	if len(selected) == 0 {
+		c.leave()
+		return c.unavailableError(NoAvailableClientError)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan error, len(selected))
+	var wg sync.WaitGroup
+	for _, cw := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- c.invoke(ctx, cw, fn)
+		}()
+	}
+	// 所有请求结束后才算离开，Close 会等待落选的请求退出
+	go func() {
+		wg.Wait()
+		cancel()
+		c.leave()
+	}()
+
+	errs := make([]error, 0, len(selected))
+	for range selected {
+		err := <-results
+		if err == nil {
+			cancel()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
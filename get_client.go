@@ -1,32 +1,150 @@
 package clientPool
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/bighu630/clientPool/clientWrapper"
 )
 
-func (c *ClientPool[T]) roundRobin() (clientWrapper.ClientWrapped[T], error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// pick 按负载均衡策略选择一个可用客户端，tried 中的客户端会被跳过；
+// 启用 WithAllowDegraded 时没有可选客户端会退回到降级选择
+func (c *ClientPool[T]) pick(ctx context.Context, balancer BalancerType, tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	cw, err := c.pickBalanced(ctx, balancer, tried)
+	if errors.Is(err, NoAvailableClientError) && c.opts.allowDegraded {
+		if degraded, ok := c.degraded(tried); ok {
+			cw, err = degraded, nil
+		}
+	}
+	if err == nil {
+		c.observeSelection(cw, balancer)
+	} else if len(tried) == 0 {
+		c.observeCircuitOpen(balancer)
+	}
+	return cw, err
+}
+
+// pickBalanced 只按负载均衡策略选择，不做降级
+func (c *ClientPool[T]) pickBalanced(ctx context.Context, balancer BalancerType, tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	switch balancer {
+	case ConsistentHash:
+		return c.consistentHash(ctx, tried)
+	case RoundRobin:
+		return c.roundRobin(tried)
+	case WeightedRandom:
+		return c.weightedRandom(tried)
+	case SmoothWeightedRoundRobin:
+		return c.smoothWeighted(tried)
+	case WeightedLeastConnections:
+		return c.leastConnections(tried)
+	case CustomBalancer:
+		return c.custom(tried)
+	default:
+		return c.random(tried)
+	}
+}
+
+// degraded 在没有可选客户端时选择最后一次失败最早的客户端（WithAllowDegraded），
+// 跳过排空中与本次调用已尝试过的客户端
+func (c *ClientPool[T]) degraded(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var best clientWrapper.ClientWrapped[T]
+	var bestFail time.Time
+	for _, cw := range c.clients {
+		if tried[cw] || cw.IsDraining() {
+			continue
+		}
+		if last := cw.GetLastFail(); best == nil || last.Before(bestFail) {
+			best, bestFail = cw, last
+		}
+	}
+	return best, best != nil
+}
+
+// eligible 判断客户端能否被选中（不修改状态）：未在排空，且可用或熔断冷却已结束且没有探测在执行
+func (c *ClientPool[T]) eligible(cw clientWrapper.ClientWrapped[T]) bool {
+	if cw.IsDraining() {
+		return false
+	}
+	if !cw.IsUnavailable() {
+		return true
+	}
+	return !cw.IsProbing() && c.since(cw.GetLastFail()) > c.cooldownOf(cw)
+}
+
+// cooledDown 根据快照判断熔断中的客户端冷却是否已结束且没有探测在执行（不修改状态）
+func (c *ClientPool[T]) cooledDown(cw clientWrapper.ClientWrapped[T], snap clientWrapper.Snapshot) bool {
+	return !snap.Probing && c.since(snap.LastFail) > c.cooldownOf(cw)
+}
+
+// since 按池的时钟返回距 t 经过的时间
+func (c *ClientPool[T]) since(t time.Time) time.Duration {
+	return c.opts.clock.Now().Sub(t)
+}
+
+// acquire 占用选中的客户端：排空中的客户端返回 false，可用的客户端直接返回 true；
+// 熔断冷却结束的客户端进入半开状态，只放行一个探测请求，其余调用者返回 false
+func (c *ClientPool[T]) acquire(cw clientWrapper.ClientWrapped[T]) bool {
+	if cw.IsDraining() {
+		return false
+	}
+	if !cw.IsUnavailable() {
+		return true
+	}
+	if c.since(cw.GetLastFail()) <= c.cooldownOf(cw) || !cw.TryProbe() {
+		return false
+	}
+	c.observeState(cw)
+	return true
+}
+
+// roundRobin 轮询选择：位置用原子计数推进，只需读锁保护客户端切片
+func (c *ClientPool[T]) roundRobin(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	var client clientWrapper.ClientWrapped[T]
-	if len(c.clients) == 0 {
+	n := uint64(len(c.clients))
+	if n == 0 {
 		return client, NoAvailableClientError
 	}
-	for i := 0; i < len(c.clients); i++ {
-		cw := c.clients[c.index%len(c.clients)]
-		c.index++
-		if cw.IsUnavailable() && time.Since(cw.GetLastFail()) > c.cooldown {
-			cw.ResetAvailable()
+	start := c.index.Add(1) - 1
+	var fallbacks []uint64
+	for i := uint64(0); i < n; i++ {
+		cw := c.clients[(start+i)%n]
+		if tried[cw] || !c.eligible(cw) {
+			continue
+		}
+		if !c.isFresh(cw) {
+			fallbacks = append(fallbacks, i)
+			continue
 		}
-		if !cw.IsUnavailable() {
+		if c.acquire(cw) {
+			c.skipTo(start, i)
+			return cw, nil
+		}
+	}
+	// 没有新鲜的客户端时退回到可用但不新鲜的客户端
+	for _, i := range fallbacks {
+		if cw := c.clients[(start+i)%n]; c.acquire(cw) {
+			c.skipTo(start, i)
 			return cw, nil
 		}
 	}
 	return client, NoAvailableClientError
 }
 
-func (c *ClientPool[T]) weightedRandom() (clientWrapper.ClientWrapped[T], error) {
+// skipTo 选中 start 之后第 offset 个客户端时，把轮询位置推进到它的下一个，
+// 避免跳过的不可用客户端让下一个客户端被连续选中；其他调用者已推进过位置时不覆盖
+func (c *ClientPool[T]) skipTo(start, offset uint64) {
+	if offset > 0 {
+		c.index.CompareAndSwap(start+1, start+offset+1)
+	}
+}
+
+func (c *ClientPool[T]) weightedRandom(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	var zero clientWrapper.ClientWrapped[T]
@@ -34,48 +152,137 @@ func (c *ClientPool[T]) weightedRandom() (clientWrapper.ClientWrapped[T], error)
 		return zero, NoAvailableClientError
 	}
 
-	// 计算总权重
-	total := 0
 	validClients := make([]clientWrapper.ClientWrapped[T], 0)
 	for _, cw := range c.clients {
-		if cw.IsUnavailable() && time.Since(cw.GetLastFail()) > c.cooldown {
-			cw.ResetAvailable()
-		}
-		if !cw.IsUnavailable() {
-			total += cw.GetWight()
+		if !tried[cw] && c.eligible(cw) {
 			validClients = append(validClients, cw)
 		}
 	}
-	if total == 0 {
-		return zero, NoAvailableClientError
+
+	// 存在新鲜的客户端时只在新鲜客户端中挑选
+	if c.opts.freshness > 0 {
+		freshClients := make([]clientWrapper.ClientWrapped[T], 0, len(validClients))
+		for _, cw := range validClients {
+			if c.isFresh(cw) {
+				freshClients = append(freshClients, cw)
+			}
+		}
+		if len(freshClients) > 0 {
+			validClients = freshClients
+		}
 	}
 
-	// 随机挑选
-	r := c.rand.Intn(total)
-	sum := 0
-	for _, cw := range validClients {
-		sum += cw.GetWight()
-		if r < sum {
-			return cw, nil
+	// 按权重随机挑选，被其他调用者抢先占用探测名额的客户端剔除后重选
+	for len(validClients) > 0 {
+		total := 0
+		for _, cw := range validClients {
+			total += cw.GetWight()
+		}
+		r := c.randIntn(total)
+		sum := 0
+		for i, cw := range validClients {
+			sum += cw.GetWight()
+			if r < sum {
+				if c.acquire(cw) {
+					return cw, nil
+				}
+				validClients = slices.Delete(validClients, i, i+1)
+				break
+			}
 		}
 	}
 
 	return zero, NoAvailableClientError
 }
 
-func (c *ClientPool[T]) random() (clientWrapper.ClientWrapped[T], error) {
+// smoothWeighted 平滑加权轮询：每轮所有可用客户端的当前权重加上有效权重，
+// 选出当前权重最大的客户端，再从它的当前权重中扣除本轮总权重。
+// 先按累加后的权重预选并占用客户端，成功后才修改权重；与其他请求竞争半开探测失败时
+// 剔除该客户端重选，权重不会因失败的选择而漂移
+func (c *ClientPool[T]) smoothWeighted(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	candidates := make([]clientWrapper.ClientWrapped[T], 0, len(c.clients))
+	for _, cw := range c.clients {
+		if !tried[cw] && c.eligible(cw) {
+			candidates = append(candidates, cw)
+		}
+	}
+	for len(candidates) > 0 {
+		bestIdx, bestWeight := -1, 0
+		for i, cw := range candidates {
+			current, effective := cw.CurrentWeight()
+			if bestIdx < 0 || current+effective > bestWeight {
+				bestIdx, bestWeight = i, current+effective
+			}
+		}
+		best := candidates[bestIdx]
+		if !c.acquire(best) {
+			candidates = slices.Delete(candidates, bestIdx, bestIdx+1)
+			continue
+		}
+		total := 0
+		for _, cw := range candidates {
+			_, effective := cw.AddCurrentWeight()
+			total += effective
+		}
+		best.SubCurrentWeight(total)
+		return best, nil
+	}
+	return nil, NoAvailableClientError
+}
+
+// leastConnections 加权最少连接：选择 inflight/weight 最小的客户端，相同时优先权重大的。
+// 权重小于 1 的客户端按 1 计算；与其他请求竞争半开探测失败时剔除该客户端重选
+func (c *ClientPool[T]) leastConnections(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	var client clientWrapper.ClientWrapped[T]
-	if len(c.clients) == 0 {
-		return client, NoAvailableClientError
+	candidates := make([]clientWrapper.ClientWrapped[T], 0, len(c.clients))
+	for _, cw := range c.clients {
+		if !tried[cw] && c.eligible(cw) {
+			candidates = append(candidates, cw)
+		}
 	}
-	cw := c.clients[c.rand.Intn(len(c.clients))]
-	if cw.IsUnavailable() && time.Since(cw.GetLastFail()) > c.cooldown {
-		cw.ResetAvailable()
+	for len(candidates) > 0 {
+		bestIdx, bestLoad, bestWeight := -1, 0, 0
+		for i, cw := range candidates {
+			load, weight := cw.Inflight(), max(cw.GetWight(), 1)
+			// 交叉相乘比较 load/weight，避免浮点误差
+			if bestIdx < 0 || load*bestWeight < bestLoad*weight || (load*bestWeight == bestLoad*weight && weight > bestWeight) {
+				bestIdx, bestLoad, bestWeight = i, load, weight
+			}
+		}
+		if best := candidates[bestIdx]; c.acquire(best) {
+			return best, nil
+		}
+		candidates = slices.Delete(candidates, bestIdx, bestIdx+1)
 	}
-	if !cw.IsUnavailable() {
-		return cw, nil
+	return nil, NoAvailableClientError
+}
+
+// random 在可选的客户端中均匀随机选择，与其他请求竞争半开探测失败时换一个，直到没有候选
+func (c *ClientPool[T]) random(tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	candidates := make([]clientWrapper.ClientWrapped[T], 0, len(c.clients))
+	for _, cw := range c.clients {
+		if !tried[cw] && c.eligible(cw) {
+			candidates = append(candidates, cw)
+		}
 	}
-	return client, NoAvailableClientError
+	for len(candidates) > 0 {
+		i := c.randIntn(len(candidates))
+		if cw := candidates[i]; c.acquire(cw) {
+			return cw, nil
+		}
+		candidates[i] = candidates[len(candidates)-1]
+		candidates = candidates[:len(candidates)-1]
+	}
+	return nil, NoAvailableClientError
+}
+
+// isFresh 判断客户端是否在新鲜度窗口内成功过，未启用时总是新鲜。
+// 冷却结束等待探测的客户端不受新鲜度限制，否则它永远没有机会恢复
+func (c *ClientPool[T]) isFresh(cw clientWrapper.ClientWrapped[T]) bool {
+	return c.opts.freshness <= 0 || cw.IsUnavailable() || c.since(cw.GetLastSuccess()) <= c.opts.freshness
 }
@@ -0,0 +1,113 @@
+package clientPool
+
+import (
+	"context"
+	"hash/crc32"
+	"slices"
+	"strconv"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// hashReplicas 每单位权重在哈希环上的虚拟节点数
+const hashReplicas = 64
+
+// hashMaxWeight 计算虚拟节点时权重的上限，避免权重很大的客户端让哈希环过大
+const hashMaxWeight = 100
+
+// hashKeyCtxKey 是一致性哈希键在 context 中的 key
+type hashKeyCtxKey struct{}
+
+// hashNode 是哈希环上的一个虚拟节点
+type hashNode[T any] struct {
+	hash   uint32
+	client clientWrapper.ClientWrapped[T]
+}
+
+// invalidateRing 标记哈希环需要重建，调用方需持有写锁。
+// 哈希环在一致性哈希第一次使用时才构建，不使用 ConsistentHash 的池没有这部分开销
+func (c *ClientPool[T]) invalidateRing() {
+	c.ringMu.Lock()
+	defer c.ringMu.Unlock()
+	c.ring = nil
+	c.ringDirty = true
+}
+
+// hashRing 返回哈希环，需要时按客户端ID与权重重建，调用方需持有读锁或写锁。
+// 每个客户端的虚拟节点数为 min(weight, hashMaxWeight)*hashReplicas
+func (c *ClientPool[T]) hashRing() []hashNode[T] {
+	c.ringMu.Lock()
+	defer c.ringMu.Unlock()
+	if !c.ringDirty {
+		return c.ring
+	}
+	ring := make([]hashNode[T], 0, len(c.clients)*hashReplicas)
+	for _, cw := range c.clients {
+		for i := 0; i < min(cw.GetWight(), hashMaxWeight)*hashReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(cw.GetClientId() + "#" + strconv.Itoa(i)))
+			ring = append(ring, hashNode[T]{hash: h, client: cw})
+		}
+	}
+	slices.SortFunc(ring, func(a, b hashNode[T]) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+	c.ring = ring
+	c.ringDirty = false
+	return ring
+}
+
+// WithHashKey 把一致性哈希的 key 放入 context，配合 DoWith(ctx, ConsistentHash, fn) 或默认策略为 ConsistentHash 的 Do 使用
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtxKey{}, key)
+}
+
+// DoHashedClient 按一致性哈希选择客户端：相同的 key 总是落到同一个可用客户端，
+// 该客户端不可用时顺着哈希环落到下一个客户端，恢复后 key 重新回到原客户端
+func (c *ClientPool[T]) DoHashedClient(ctx context.Context, key string, fn func(ctx context.Context, client T) error) error {
+	_, err := c.do(WithHashKey(ctx, key), ConsistentHash, fn)
+	return err
+}
+
+// consistentHash 从 key 在哈希环上的位置开始顺时针查找第一个可选的客户端。
+// context 中没有 key 时（如把 ConsistentHash 作为默认策略直接调用 Do）退回到随机选择
+func (c *ClientPool[T]) consistentHash(ctx context.Context, tried map[clientWrapper.ClientWrapped[T]]bool) (clientWrapper.ClientWrapped[T], error) {
+	key, ok := ctx.Value(hashKeyCtxKey{}).(string)
+	if !ok {
+		return c.random(tried)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ring := c.hashRing()
+	if len(ring) == 0 {
+		return nil, NoAvailableClientError
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	start, _ := slices.BinarySearchFunc(ring, h, func(n hashNode[T], h uint32) int {
+		switch {
+		case n.hash < h:
+			return -1
+		case n.hash > h:
+			return 1
+		}
+		return 0
+	})
+	// 同一客户端有多个虚拟节点，只需判断一次
+	seen := make(map[clientWrapper.ClientWrapped[T]]bool, len(c.clients))
+	for i := 0; i < len(ring) && len(seen) < len(c.clients); i++ {
+		cw := ring[(start+i)%len(ring)].client
+		if seen[cw] {
+			continue
+		}
+		seen[cw] = true
+		if !tried[cw] && c.eligible(cw) && c.acquire(cw) {
+			return cw, nil
+		}
+	}
+	return nil, NoAvailableClientError
+}
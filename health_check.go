@@ -0,0 +1,81 @@
+package clientPool
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// StartHealthCheck 启动后台健康检查：每隔 interval 对熔断中的客户端执行 probe，
+// 成功则立即恢复，不必等待冷却结束或线上流量试探。可用的客户端不会被探测。
+// 返回的 stop 函数会等待后台 goroutine 退出，可重复调用；Close 时也会自动停止。
+// interval 必须为正数，否则在调用方 panic，而不是在后台 goroutine 中崩溃
+func (c *ClientPool[T]) StartHealthCheck(interval time.Duration, probe func(ctx context.Context, client T) error) (stop func()) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("clientPool: non-positive health check interval %v", interval))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.probeUnavailable(ctx, interval, probe)
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	c.addBackground(stop)
+	return stop
+}
+
+// probeUnavailable 探测所有熔断中的客户端，单次探测的超时为 timeout
+func (c *ClientPool[T]) probeUnavailable(ctx context.Context, timeout time.Duration, probe func(ctx context.Context, client T) error) {
+	c.mu.RLock()
+	clients := slices.Clone(c.clients)
+	c.mu.RUnlock()
+
+	for _, cw := range clients {
+		if ctx.Err() != nil {
+			return
+		}
+		if !cw.IsUnavailable() {
+			continue
+		}
+		if err := c.runProbe(ctx, timeout, cw, probe); err == nil {
+			c.markSuccess(cw)
+		}
+	}
+}
+
+// runProbe 执行一次探测，probe 的 panic 被视为探测失败
+func (c *ClientPool[T]) runProbe(ctx context.Context, timeout time.Duration, cw clientWrapper.ClientWrapped[T], probe func(ctx context.Context, client T) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("health check panic recovered: %v", r)
+		}
+	}()
+	client, err := cw.Build()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return probe(ctx, client)
+}
@@ -0,0 +1,100 @@
+package clientPool
+
+import (
+	"sync"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+	"github.com/bighu630/clientPool/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 熔断状态取值
+const (
+	circuitClosed   = 0
+	circuitHalfOpen = 1
+	circuitOpen     = 2
+)
+
+var (
+	circuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "clientpool_circuit_state",
+			Help: "Circuit breaker state of each client (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"client"},
+	)
+
+	selectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "clientpool_selections_total",
+			Help: "Number of times a balancer selected each client, including probe and degraded selections",
+		},
+		[]string{"client", "balancer"},
+	)
+
+	circuitOpenTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "clientpool_circuit_open_total",
+			Help: "Number of requests rejected before reaching any client because no client was available",
+		},
+		[]string{"balancer"},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics 懒注册池级别指标，多个池共享同一组指标，只注册一次。
+// 全局 registry 上已有同名同结构的指标时复用它，不会 panic
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		circuitState = middleware.RegisterOrReuse(prometheus.DefaultRegisterer, circuitState)
+		selectionsTotal = middleware.RegisterOrReuse(prometheus.DefaultRegisterer, selectionsTotal)
+		circuitOpenTotal = middleware.RegisterOrReuse(prometheus.DefaultRegisterer, circuitOpenTotal)
+	})
+}
+
+// observeState 将客户端当前的熔断状态同步到指标
+func (c *ClientPool[T]) observeState(cw clientWrapper.ClientWrapped[T]) {
+	if !c.opts.metrics {
+		return
+	}
+	circuitState.WithLabelValues(cw.GetClientId()).Set(float64(circuitValue(cw.Snapshot())))
+}
+
+// observeSelection 记录负载均衡器选中了客户端，在执行中间件与 fn 之前调用
+func (c *ClientPool[T]) observeSelection(cw clientWrapper.ClientWrapped[T], balancer BalancerType) {
+	if !c.opts.metrics {
+		return
+	}
+	selectionsTotal.WithLabelValues(cw.GetClientId(), string(balancer)).Inc()
+}
+
+// observeCircuitOpen 记录一次因没有可用客户端而在到达任何客户端之前被拒绝的请求。
+// 请求被拒绝时中间件链不会执行，因此这类错误不会出现在 Prometheus 中间件的错误指标中
+func (c *ClientPool[T]) observeCircuitOpen(balancer BalancerType) {
+	if !c.opts.metrics {
+		return
+	}
+	circuitOpenTotal.WithLabelValues(string(balancer)).Inc()
+}
+
+// circuitValue 把熔断器状态映射为指标取值，排空与否不影响取值
+func circuitValue(snap clientWrapper.Snapshot) int {
+	switch {
+	case snap.Unavailable && snap.Probing:
+		return circuitHalfOpen
+	case snap.Unavailable:
+		return circuitOpen
+	default:
+		return circuitClosed
+	}
+}
+
+// forgetState 删除客户端对应的指标序列
+func (c *ClientPool[T]) forgetState(cw clientWrapper.ClientWrapped[T]) {
+	if !c.opts.metrics {
+		return
+	}
+	circuitState.DeleteLabelValues(cw.GetClientId())
+	selectionsTotal.DeletePartialMatch(prometheus.Labels{"client": cw.GetClientId()})
+}
@@ -1,6 +1,11 @@
 package middleware
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
 
 // MiddlewareError 表示中间件自身产生的错误（如限流超时），
 // 与业务逻辑错误区分，避免误触发熔断。
@@ -26,3 +31,48 @@ func IsMiddlewareError(err error) bool {
 	_, ok := err.(*MiddlewareError)
 	return ok
 }
+
+// 内置的错误分类，用作 Prometheus 错误指标的 error_type 标签
+const (
+	ErrorTypeTimeout    = "timeout"
+	ErrorTypeCanceled   = "canceled"
+	ErrorTypeMiddleware = "middleware"
+	ErrorTypeOther      = "other"
+)
+
+// ErrorClassifier 把错误映射为 error_type 标签值，无法识别时返回空字符串。
+// 返回值应来自有限的集合，避免标签基数膨胀
+type ErrorClassifier func(err error) string
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   []ErrorClassifier
+)
+
+// RegisterErrorClassifier 注册自定义错误分类器，按注册顺序在内置的超时/取消判断之后依次尝试
+func RegisterErrorClassifier(classifier ErrorClassifier) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	classifiers = append(classifiers, classifier)
+}
+
+// ClassifyError 返回错误的 error_type 标签值，无法识别的错误归为 "other"
+func ClassifyError(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	}
+	classifiersMu.RLock()
+	defer classifiersMu.RUnlock()
+	for _, classify := range classifiers {
+		if t := classify(err); t != "" {
+			return t
+		}
+	}
+	if IsMiddlewareError(err) {
+		return ErrorTypeMiddleware
+	}
+	return ErrorTypeOther
+}
@@ -24,3 +24,16 @@ func (m middlewareWrapper[T]) Execute(ctx context.Context, client cw.ClientWrapp
 func WrapMiddleware[T any](fn MiddlewareFunc[T]) Middleware[T] {
 	return middlewareWrapper[T]{fn: fn}
 }
+
+type clientIDKey struct{}
+
+// WithClientID 把选中客户端的ID放入 context，池在执行中间件链前自动调用
+func WithClientID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, id)
+}
+
+// ClientIDFromContext 返回池为本次请求选中的客户端ID，中间件与业务函数都可以读取；不存在时返回空字符串
+func ClientIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(clientIDKey{}).(string)
+	return id
+}
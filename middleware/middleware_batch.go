@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// BatchFlushFunc 用一次批量调用处理 batch 中的所有请求，batch 按请求到达顺序排列，
+// 调用方通常从每个 context 中取出各自的参数与结果容器
+type BatchFlushFunc[T any] func(ctx context.Context, client T, batch []context.Context) error
+
+// BatchMiddleware 把 window 内落到同一客户端的请求合并为一次 flush 调用。
+//
+// 语义：
+//   - 批次按客户端ID分组，第一个请求到达时开始计时，window 到期或请求数达到 maxBatch 时 flush
+//   - 批次内的请求不会调用 next（业务函数与内层中间件都被跳过），由 flush 完成实际调用，
+//     因此该中间件应注册在最内层
+//   - flush 的返回值原样返回给批次内的每个调用者，熔断按每个调用者各计一次结果；
+//     单个请求的成败需通过 context 中的结果容器传递
+//   - flush 使用批次第一个请求的 context（去掉取消），调用者在等待期间被取消时立即返回 ctx.Err()，
+//     但它仍留在批次中
+//   - flush panic 时转换为错误返回给批次内所有调用者
+type BatchMiddleware[T any] struct {
+	window   time.Duration
+	maxBatch int
+	flush    BatchFlushFunc[T]
+
+	mu      sync.Mutex
+	pending map[string]*batch[T] // 每个客户端正在累积的批次
+}
+
+type batch[T any] struct {
+	client cw.ClientWrapped[T]
+	ctxs   []context.Context
+	timer  *time.Timer
+	done   chan struct{} // flush 结束后关闭
+	err    error
+}
+
+// NewBatchMiddleware 创建批量合并中间件，maxBatch <= 0 表示只按 window 触发 flush
+func NewBatchMiddleware[T any](window time.Duration, maxBatch int, flush func(ctx context.Context, client T, batch []context.Context) error) Middleware[T] {
+	return &BatchMiddleware[T]{
+		window:   window,
+		maxBatch: maxBatch,
+		flush:    flush,
+		pending:  make(map[string]*batch[T]),
+	}
+}
+
+func (m *BatchMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	id := client.GetClientId()
+	m.mu.Lock()
+	b := m.pending[id]
+	if b == nil {
+		b = &batch[T]{client: client, done: make(chan struct{})}
+		m.pending[id] = b
+		b.timer = time.AfterFunc(m.window, func() { m.flushPending(id, b) })
+	}
+	b.ctxs = append(b.ctxs, ctx)
+	full := m.maxBatch > 0 && len(b.ctxs) >= m.maxBatch
+	if full {
+		delete(m.pending, id)
+		b.timer.Stop()
+	}
+	m.mu.Unlock()
+
+	if full {
+		m.run(b)
+	}
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushPending 在 window 到期时 flush 批次，批次已因达到 maxBatch 被取走时不做任何事
+func (m *BatchMiddleware[T]) flushPending(id string, b *batch[T]) {
+	m.mu.Lock()
+	if m.pending[id] != b {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.pending, id)
+	m.mu.Unlock()
+	m.run(b)
+}
+
+// run 执行 flush 并唤醒批次内的所有调用者，批次从 pending 中取出后才会调用，因此不会再有新请求加入
+func (m *BatchMiddleware[T]) run(b *batch[T]) {
+	defer close(b.done)
+	defer func() {
+		if r := recover(); r != nil {
+			b.err = fmt.Errorf("batch flush panic: %v", r)
+		}
+	}()
+	cl, err := b.client.Build()
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.err = m.flush(context.WithoutCancel(b.ctxs[0]), cl, b.ctxs)
+}
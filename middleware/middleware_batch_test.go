@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+type batchIndexKey struct{}
+
+func TestBatchMiddleware(t *testing.T) {
+	const callers = 5
+	errBatch := errors.New("batch error")
+	var mu sync.Mutex
+	var flushes [][]int
+	m := NewBatchMiddleware[string](time.Hour, callers, func(ctx context.Context, client string, batch []context.Context) error {
+		var indexes []int
+		for _, c := range batch {
+			indexes = append(indexes, c.Value(batchIndexKey{}).(int))
+		}
+		mu.Lock()
+		flushes = append(flushes, indexes)
+		mu.Unlock()
+		return errBatch
+	})
+	client := cw.NewClientWrapper("client", "client", 1)
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		t.Error("next should not be called for batched requests")
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), batchIndexKey{}, i)
+			errs[i] = m.Execute(ctx, client, next)
+		}()
+	}
+	wg.Wait()
+
+	if len(flushes) != 1 || len(flushes[0]) != callers {
+		t.Fatalf("expected one flush of %d requests, got %v", callers, flushes)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, errBatch) {
+			t.Fatalf("caller %d: expected batch error, got %v", i, err)
+		}
+	}
+}
+
+func TestBatchMiddleware_Window(t *testing.T) {
+	var sizes []int
+	m := NewBatchMiddleware[string](100*time.Millisecond, 0, func(ctx context.Context, client string, batch []context.Context) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	client := cw.NewClientWrapper("client", "client", 1)
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Execute(context.Background(), client, next); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(sizes) != 1 || sizes[0] != 3 {
+		t.Fatalf("expected the window to flush one batch of 3, got %v", sizes)
+	}
+
+	// 等待中被取消的调用者立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Execute(ctx, client, next); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// ErrBulkheadFull 表示并发数已满且在等待时间内没有空出名额
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+type BulkheadMiddleware[T any] struct {
+	sem            chan struct{}
+	acquireTimeout time.Duration
+}
+
+// NewBulkheadMiddleware 限制整个池同时进行中的请求数为 maxConcurrent。
+// 等待名额超过 acquireTimeout 时返回 ErrBulkheadFull 且不调用 next；acquireTimeout <= 0 时只受 ctx 控制。
+// maxConcurrent 小于 1 时按 1 处理
+func NewBulkheadMiddleware[T any](maxConcurrent int, acquireTimeout time.Duration) Middleware[T] {
+	return &BulkheadMiddleware[T]{
+		sem:            make(chan struct{}, max(maxConcurrent, 1)),
+		acquireTimeout: acquireTimeout,
+	}
+}
+
+func (b *BulkheadMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	if err := acquireSemaphore(ctx, b.sem, b.acquireTimeout); err != nil {
+		return NewMiddlewareError("bulkhead", err)
+	}
+	// defer 释放，保证 next panic 时名额也能归还
+	defer func() { <-b.sem }()
+	return next(ctx, client)
+}
+
+// PerClientBulkheadMiddleware 按客户端ID分别限制并发数，一个慢上游占满名额不会影响其他客户端
+type PerClientBulkheadMiddleware[T any] struct {
+	mu             sync.Mutex
+	sems           map[string]chan struct{}
+	maxPerClient   int
+	acquireTimeout time.Duration
+}
+
+// NewPerClientBulkheadMiddleware 限制每个客户端同时进行中的请求数为 maxPerClient，超时行为与 NewBulkheadMiddleware 相同。
+// 每个出现过的客户端ID都会保留一个信号量，客户端被移除后不会清理，
+// 客户端ID频繁变化（如每次热加载生成新ID）时需要注意这部分内存。maxPerClient 小于 1 时按 1 处理
+func NewPerClientBulkheadMiddleware[T any](maxPerClient int, acquireTimeout time.Duration) Middleware[T] {
+	return &PerClientBulkheadMiddleware[T]{
+		sems:           make(map[string]chan struct{}),
+		maxPerClient:   max(maxPerClient, 1),
+		acquireTimeout: acquireTimeout,
+	}
+}
+
+func (b *PerClientBulkheadMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	sem := b.semaphore(client.GetClientId())
+	if err := acquireSemaphore(ctx, sem, b.acquireTimeout); err != nil {
+		return NewMiddlewareError("bulkhead", err)
+	}
+	defer func() { <-sem }()
+	return next(ctx, client)
+}
+
+// semaphore 返回客户端对应的信号量，不存在时创建
+func (b *PerClientBulkheadMiddleware[T]) semaphore(id string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sem, ok := b.sems[id]
+	if !ok {
+		sem = make(chan struct{}, b.maxPerClient)
+		b.sems[id] = sem
+	}
+	return sem
+}
+
+// acquireSemaphore 在 timeout 内获取信号量名额，超时返回 ErrBulkheadFull
+func acquireSemaphore(ctx context.Context, sem chan struct{}, timeout time.Duration) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	default:
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-expired:
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
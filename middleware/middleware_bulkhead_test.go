@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestBulkheadMiddleware(t *testing.T) {
+	m := NewBulkheadMiddleware[string](2, 10*time.Millisecond)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	var running, calls atomic.Int32
+	release := make(chan struct{})
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls.Add(1)
+		running.Add(1)
+		defer running.Add(-1)
+		<-release
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var full atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.Execute(context.Background(), client, next)
+			if errors.Is(err, ErrBulkheadFull) {
+				if !IsMiddlewareError(err) {
+					t.Error("bulkhead error should be a middleware error")
+				}
+				full.Add(1)
+			}
+		}()
+	}
+	// 超出限制的请求等待超时后返回
+	for full.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := running.Load(); n != 2 {
+		t.Errorf("expected 2 running requests, got %d", n)
+	}
+	close(release)
+	wg.Wait()
+	if calls.Load() != 2 || full.Load() != 3 {
+		t.Fatalf("expected 2 calls and 3 rejections, got %d calls and %d rejections", calls.Load(), full.Load())
+	}
+
+	// panic 后名额仍然归还
+	func() {
+		defer func() { _ = recover() }()
+		_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			panic("boom")
+		})
+	}()
+	for i := 0; i < 2; i++ {
+		if err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }); err != nil {
+			t.Fatalf("expected slot to be released after panic, got %v", err)
+		}
+	}
+}
+
+func TestPerClientBulkheadMiddleware(t *testing.T) {
+	m := NewPerClientBulkheadMiddleware[string](2, 10*time.Millisecond)
+	clients := []cw.ClientWrapped[string]{
+		cw.NewClientWrapper("a", "a", 1),
+		cw.NewClientWrapper("b", "b", 1),
+	}
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	release := make(chan struct{})
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		mu.Lock()
+		running[client.GetClientId()]++
+		mu.Unlock()
+		<-release
+		return nil
+	}
+
+	// 每个客户端各发起 3 个请求，各自的第 3 个请求被拒绝，互不影响
+	var wg sync.WaitGroup
+	var full atomic.Int32
+	for _, client := range clients {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if errors.Is(m.Execute(context.Background(), client, next), ErrBulkheadFull) {
+					full.Add(1)
+				}
+			}()
+		}
+	}
+	for full.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	if running["a"] != 2 || running["b"] != 2 {
+		t.Errorf("expected 2 running requests per client, got %v", running)
+	}
+	mu.Unlock()
+	close(release)
+	wg.Wait()
+	if full.Load() != 2 {
+		t.Fatalf("expected 1 rejection per client, got %d", full.Load())
+	}
+}
+
+func TestBulkheadMiddleware_NonPositiveLimit(t *testing.T) {
+	client := cw.NewClientWrapper("client", "client", 1)
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+	for _, n := range []int{0, -1} {
+		// 非正数按 1 处理：请求可以通过，不会 panic 或一直被拒绝
+		for _, m := range []Middleware[string]{
+			NewBulkheadMiddleware[string](n, 10*time.Millisecond),
+			NewPerClientBulkheadMiddleware[string](n, 10*time.Millisecond),
+		} {
+			if err := m.Execute(context.Background(), client, next); err != nil {
+				t.Fatalf("limit %d: expected request to pass, got %v", n, err)
+			}
+		}
+	}
+}
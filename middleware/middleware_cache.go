@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// CacheMiddleware 缓存幂等请求的成功结果。
+// 中间件只能看到 next 返回的 error，看不到业务返回值，因此这里缓存的是“该请求已成功”这一事实：
+// 命中时直接返回 nil，不再调用 next。失败结果不缓存，以免掩盖客户端恢复。
+// 需要复用返回值时，可以在 keyFn 对应的 context 中放入由调用方自行维护的结果容器
+type CacheMiddleware[T any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	keyFn   func(ctx context.Context) (string, bool)
+	entries map[string]time.Time // key -> 过期时间
+}
+
+// NewCacheMiddleware 创建缓存中间件，keyFn 返回 ok=false 的请求不参与缓存
+func NewCacheMiddleware[T any](ttl time.Duration, keyFn func(ctx context.Context) (string, bool)) Middleware[T] {
+	return &CacheMiddleware[T]{
+		ttl:     ttl,
+		keyFn:   keyFn,
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (m *CacheMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	key, ok := m.keyFn(ctx)
+	if !ok {
+		return next(ctx, client)
+	}
+	if m.hit(key) {
+		return nil
+	}
+	err := next(ctx, client)
+	if err == nil {
+		m.mu.Lock()
+		m.entries[key] = time.Now().Add(m.ttl)
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// hit 判断 key 是否命中未过期的缓存，过期条目顺带删除
+func (m *CacheMiddleware[T]) hit(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expire, ok := m.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expire) {
+		delete(m.entries, key)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+type cacheKey struct{}
+
+func TestCacheMiddleware(t *testing.T) {
+	m := NewCacheMiddleware[string](50*time.Millisecond, func(ctx context.Context) (string, bool) {
+		key, ok := ctx.Value(cacheKey{}).(string)
+		return key, ok
+	})
+	client := cw.NewClientWrapper("client", "client", 1)
+	calls := 0
+	var result error
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		return result
+	}
+	ctx := context.WithValue(context.Background(), cacheKey{}, "get:1")
+
+	// 失败结果不缓存
+	result = errors.New("upstream error")
+	if err := m.Execute(ctx, client, next); err == nil {
+		t.Fatal("expected error to be returned")
+	}
+	result = nil
+	for i := 0; i < 3; i++ {
+		if err := m.Execute(ctx, client, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected cache hits after first success, got %d calls", calls)
+	}
+
+	// 没有 key 的请求不参与缓存
+	_ = m.Execute(context.Background(), client, next)
+	if calls != 3 {
+		t.Fatalf("expected uncached request to call next, got %d calls", calls)
+	}
+
+	// 过期后重新调用 next
+	time.Sleep(60 * time.Millisecond)
+	_ = m.Execute(ctx, client, next)
+	if calls != 4 {
+		t.Fatalf("expected expired entry to call next, got %d calls", calls)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// NewErrorWrapMiddleware 把 next 返回的错误包装为 "client=<id> method=<method>: <err>"，
+// 方法名取自 PrometheusMethodKey，errors.Is/As 仍然可用。
+// 中间件错误只包装其内部错误并保持 *MiddlewareError 类型，避免被当作业务错误触发熔断
+func NewErrorWrapMiddleware[T any]() Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		err := next(ctx, client)
+		if err == nil {
+			return nil
+		}
+		id, method := client.GetClientId(), GetPrometheusMethodName(ctx)
+		if me, ok := err.(*MiddlewareError); ok {
+			return NewMiddlewareError(me.Middleware, fmt.Errorf("client=%s method=%s: %w", id, method, me.Err))
+		}
+		return fmt.Errorf("client=%s method=%s: %w", id, method, err)
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+type upstreamError struct{ code int }
+
+func (e *upstreamError) Error() string { return "upstream failed" }
+
+func TestErrorWrapMiddleware(t *testing.T) {
+	m := NewErrorWrapMiddleware[string]()
+	client := cw.NewClientWrapper("client", "client-a", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+
+	errUpstream := &upstreamError{code: 503}
+	err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errUpstream
+	})
+	if got, want := err.Error(), "client=client-a method=get_slot: upstream failed"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if !errors.Is(err, errUpstream) {
+		t.Fatalf("expected errors.Is to find the upstream error")
+	}
+	var target *upstreamError
+	if !errors.As(err, &target) || target.code != 503 {
+		t.Fatalf("expected errors.As to find the upstream error, got %v", target)
+	}
+
+	if err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("expected nil error to pass through, got %v", err)
+	}
+
+	// 中间件错误保持类型，不会被当作业务错误
+	err = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return NewMiddlewareError("rate limiter", context.DeadlineExceeded)
+	})
+	if !IsMiddlewareError(err) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected wrapped middleware error, got %v", err)
+	}
+	if got, want := err.Error(), "middleware [rate limiter]: client=client-a method=get_slot: context deadline exceeded"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// Event 是一次请求的结果，由 EventMiddleware 发送
+type Event struct {
+	ClientID  string
+	Method    string // 来自 PrometheusMethodKey，未设置时为空
+	Duration  time.Duration
+	Err       error
+	Timestamp time.Time // 请求开始时间
+}
+
+// EventMiddleware 把每次请求的结果发送到 channel，供自定义监控管道消费。
+// 发送不会阻塞请求：channel 满时丢弃事件并计数，可通过 Dropped 查看
+type EventMiddleware[T any] struct {
+	ch      chan<- Event
+	dropped atomic.Uint64
+}
+
+// NewEventMiddleware 创建事件中间件，ch 应有足够的缓冲并被及时消费
+func NewEventMiddleware[T any](ch chan<- Event) *EventMiddleware[T] {
+	return &EventMiddleware[T]{ch: ch}
+}
+
+func (m *EventMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	start := time.Now()
+	err := next(ctx, client)
+	event := Event{
+		ClientID:  client.GetClientId(),
+		Method:    GetPrometheusMethodName(ctx),
+		Duration:  time.Since(start),
+		Err:       err,
+		Timestamp: start,
+	}
+	select {
+	case m.ch <- event:
+	default:
+		m.dropped.Add(1)
+	}
+	return err
+}
+
+// Dropped 返回因 channel 已满而丢弃的事件数
+func (m *EventMiddleware[T]) Dropped() uint64 {
+	return m.dropped.Load()
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestEventMiddleware(t *testing.T) {
+	ch := make(chan Event, 2)
+	m := NewEventMiddleware[string](ch)
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+
+	errUpstream := errors.New("upstream error")
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return errUpstream })
+
+	ok, failed := <-ch, <-ch
+	if ok.ClientID != "client-1" || ok.Method != "get_slot" || ok.Err != nil {
+		t.Fatalf("unexpected event: %+v", ok)
+	}
+	if ok.Duration < time.Millisecond || ok.Timestamp.IsZero() {
+		t.Fatalf("unexpected timing: %+v", ok)
+	}
+	if failed.Err != errUpstream {
+		t.Fatalf("expected upstream error, got %v", failed.Err)
+	}
+}
+
+func TestEventMiddleware_NonBlocking(t *testing.T) {
+	ch := make(chan Event, 1)
+	m := NewEventMiddleware[string](ch)
+	client := cw.NewClientWrapper("client", "client-1", 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request path blocked on a full channel")
+	}
+	if n := m.Dropped(); n != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", n)
+	}
+}
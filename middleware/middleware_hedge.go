@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// NewHedgeMiddleware 对慢请求发起对冲：next 在 delay 内没有返回时再并发调用一次，
+// 最多额外发起 maxHedges 次，返回第一个成功的结果并通过 context 取消其余调用；
+// 所有已发起的调用都失败时返回最后一个错误。
+//
+// 对冲发生在已选中的客户端上，每次对冲都会完整执行内层中间件与业务函数。
+// 与限流中间件配合时注意顺序：限流注册在对冲之前（外层）时整个对冲只消耗一个令牌，
+// 注册在之后（内层）时每次对冲都会消耗令牌，可能因限流等待而失去对冲的意义。
+// maxHedges 为 0 时不对冲，负数按 0 处理
+func NewHedgeMiddleware[T any](delay time.Duration, maxHedges int) Middleware[T] {
+	maxHedges = max(maxHedges, 0)
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		hedgeCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// 缓冲足够大，返回后仍在运行的调用不会阻塞
+		results := make(chan error, maxHedges+1)
+		launch := func() {
+			go func() {
+				results <- callRecovered(hedgeCtx, client, next)
+			}()
+		}
+
+		launch()
+		launched, finished := 1, 0
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		var lastErr error
+		for {
+			select {
+			case err := <-results:
+				finished++
+				if err == nil {
+					return nil
+				}
+				lastErr = err
+				if finished == launched {
+					return lastErr
+				}
+			case <-timer.C:
+				if launched <= maxHedges {
+					launch()
+					launched++
+					timer.Reset(delay)
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// callRecovered 在独立 goroutine 中调用 next 时捕获 panic，外层 RecoverMiddleware 无法覆盖其他 goroutine
+func callRecovered[T any](ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic recovered: %v", r)
+		}
+	}()
+	return next(ctx, client)
+}
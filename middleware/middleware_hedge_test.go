@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestHedgeMiddleware(t *testing.T) {
+	m := NewHedgeMiddleware[string](10*time.Millisecond, 2)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	var attempts atomic.Int32
+	firstCancelled := make(chan struct{})
+	start := time.Now()
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		if attempts.Add(1) == 1 {
+			// 第一次调用很慢，直到被取消
+			<-ctx.Done()
+			close(firstCancelled)
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected hedge to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedge took too long: %v", elapsed)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+	select {
+	case <-firstCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("slow attempt was not cancelled")
+	}
+
+	// 快速失败时不发起对冲
+	attempts.Store(0)
+	errUpstream := errors.New("upstream error")
+	err = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		attempts.Add(1)
+		return errUpstream
+	})
+	if !errors.Is(err, errUpstream) || attempts.Load() != 1 {
+		t.Fatalf("expected single failed attempt, got %v after %d attempts", err, attempts.Load())
+	}
+}
+
+func TestHedgeMiddleware_NoHedges(t *testing.T) {
+	client := cw.NewClientWrapper("client", "client", 1)
+	for _, maxHedges := range []int{0, -5} {
+		m := NewHedgeMiddleware[string](time.Millisecond, maxHedges)
+		var attempts atomic.Int32
+		err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			attempts.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		if err != nil || attempts.Load() != 1 {
+			t.Fatalf("maxHedges=%d: expected a single call without hedging, got %v after %d calls", maxHedges, err, attempts.Load())
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// NewLoggingMiddleware 使用 slog 记录每个请求的客户端、方法、耗时与错误：
+// 成功以 Info 级别记录，next 返回错误时以 Error 级别记录。logger 为 nil 时使用 slog.Default()
+func NewLoggingMiddleware[T any](logger *slog.Logger) Middleware[T] {
+	return NewSampledLoggingMiddleware[T](logger, nil)
+}
+
+// NewSampledLoggingMiddleware 与 NewLoggingMiddleware 相同，但成功的请求只按 sampler 采样记录，
+// 失败的请求与 WithForceSample 标记的请求总是记录。sampler 为 nil 时全部记录
+func NewSampledLoggingMiddleware[T any](logger *slog.Logger, sampler Sampler) Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		sampled := ShouldSample(ctx, sampler)
+		start := time.Now()
+		err := next(ctx, client)
+		if err == nil && !sampled {
+			return nil
+		}
+
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+		attrs := []slog.Attr{
+			slog.String("client", client.GetClientId()),
+			slog.String("method", GetPrometheusMethodName(ctx)),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			l.LogAttrs(ctx, slog.LevelError, "client pool request failed", attrs...)
+		} else {
+			l.LogAttrs(ctx, slog.LevelInfo, "client pool request", attrs...)
+		}
+		return err
+	})
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// captureHandler 记录所有日志，便于断言
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	h := &captureHandler{}
+	m := NewLoggingMiddleware[string](slog.New(h))
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+	errUpstream := errors.New("upstream error")
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return errUpstream })
+
+	if len(h.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(h.records))
+	}
+	ok, failed := h.records[0], h.records[1]
+	if ok.Level != slog.LevelInfo || failed.Level != slog.LevelError {
+		t.Fatalf("unexpected levels: %v, %v", ok.Level, failed.Level)
+	}
+	attrs := recordAttrs(failed)
+	if attrs["client"].String() != "client-1" || attrs["method"].String() != "get_slot" {
+		t.Fatalf("unexpected attrs: %v", attrs)
+	}
+	if _, ok := attrs["duration"]; !ok {
+		t.Fatal("missing duration attr")
+	}
+	if attrs["error"].Any() != errUpstream {
+		t.Fatalf("unexpected error attr: %v", attrs["error"])
+	}
+	if _, ok := recordAttrs(ok)["error"]; ok {
+		t.Fatal("successful request should not log an error")
+	}
+}
+
+func TestSampledLoggingMiddleware(t *testing.T) {
+	h := &captureHandler{}
+	m := NewSampledLoggingMiddleware[string](slog.New(h), NewEveryNSampler(100))
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	for i := 0; i < 10; i++ {
+		_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+	}
+	// 失败总是记录
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return errors.New("boom") })
+	if len(h.records) != 2 {
+		t.Fatalf("expected 1 sampled success and 1 error, got %d records", len(h.records))
+	}
+}
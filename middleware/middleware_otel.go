@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewOTelMiddleware 为每个请求创建 OpenTelemetry span：span 名为方法标签（PrometheusMethodKey），
+// 属性包含客户端 ID 与错误类型；next 返回错误时记录错误并把状态设为 Error
+func NewOTelMiddleware[T any](tracer trace.Tracer) Middleware[T] {
+	return NewSampledOTelMiddleware[T](tracer, nil)
+}
+
+// NewSampledOTelMiddleware 与 NewOTelMiddleware 相同，但成功的请求只按 sampler 采样，
+// 失败的请求与 WithForceSample 标记的请求总是记录。sampler 为 nil 时全部记录。
+// 未采样的请求在失败后才补建 span（起止时间与请求一致），span 不会传入 next 的 context
+func NewSampledOTelMiddleware[T any](tracer trace.Tracer, sampler Sampler) Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		name := GetPrometheusMethodName(ctx)
+		clientAttr := attribute.String("clientpool.client_id", client.GetClientId())
+		if ShouldSample(ctx, sampler) {
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(clientAttr))
+			defer span.End()
+			err := next(ctx, client)
+			recordSpanError(span, err)
+			return err
+		}
+
+		start := time.Now()
+		err := next(ctx, client)
+		if err != nil {
+			_, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(clientAttr), trace.WithTimestamp(start))
+			recordSpanError(span, err)
+			span.End()
+		}
+		return err
+	})
+}
+
+// recordSpanError 在 err 不为 nil 时记录错误、错误类型并把 span 状态设为 Error
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetAttributes(attribute.String("clientpool.error_type", ClassifyError(err)))
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOTelMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	m := NewOTelMiddleware[string](provider.Tracer("clientpool"))
+	client := cw.NewClientWrapper("client", "client-a", 1)
+
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+	errUpstream := errors.New("upstream error")
+	err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errUpstream
+	})
+	if !errors.Is(err, errUpstream) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+	if err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	failed, ok := spans[0], spans[1]
+	if failed.Name != "get_slot" {
+		t.Fatalf("expected span name get_slot, got %q", failed.Name)
+	}
+	if failed.Status.Code != codes.Error || len(failed.Events) == 0 {
+		t.Fatalf("expected error status with recorded error, got %+v", failed.Status)
+	}
+	if !hasAttr(failed.Attributes, attribute.String("clientpool.client_id", "client-a")) {
+		t.Fatalf("expected client id attribute, got %v", failed.Attributes)
+	}
+	if ok.Status.Code == codes.Error {
+		t.Fatalf("expected successful span not to have error status")
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSampledOTelMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	never := SamplerFunc(func(ctx context.Context) bool { return false })
+	m := NewSampledOTelMiddleware[string](provider.Tracer("clientpool"), never)
+	client := cw.NewClientWrapper("client", "client-a", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+
+	// 未采样的成功请求不记录
+	if err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Fatalf("expected unsampled success to produce no span, got %d", n)
+	}
+
+	// 失败的请求总是记录
+	errUpstream := errors.New("upstream error")
+	if err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errUpstream
+	}); !errors.Is(err, errUpstream) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected failed request to be traced, got %d spans", len(spans))
+	}
+	if spans[0].Name != "get_slot" || spans[0].Status.Code != codes.Error || len(spans[0].Events) == 0 {
+		t.Fatalf("expected error span for get_slot, got %q %+v", spans[0].Name, spans[0].Status)
+	}
+	if !hasAttr(spans[0].Attributes, attribute.String("clientpool.client_id", "client-a")) {
+		t.Fatalf("expected client id attribute, got %v", spans[0].Attributes)
+	}
+
+	// 强制采样的成功请求也记录
+	if err := m.Execute(WithForceSample(ctx), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exporter.GetSpans()); n != 2 {
+		t.Fatalf("expected force sampled request to be traced, got %d spans", n)
+	}
+}
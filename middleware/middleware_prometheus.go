@@ -2,43 +2,126 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	cw "github.com/bighu630/clientPool/clientWrapper"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// defaultBuckets 是默认的请求耗时直方图分桶（秒）
+var defaultBuckets = []float64{0.1, 0.2, 0.5, 1.0, 5.0}
+
+// defaultMetricsPrefix 是指标名的默认前缀
+const defaultMetricsPrefix = "middleware"
+
+// PrometheusOption 配置 Prometheus 中间件
+type PrometheusOption func(*prometheusConfig)
+
+type prometheusConfig struct {
+	prefix     string                // 指标名前缀
+	registerer prometheus.Registerer // 指标注册的 registry
+}
+
+// WithMetricsPrefix 设置指标名前缀，如 "myapp_clientpool" 得到 myapp_clientpool_requests_total，
+// 默认为 "middleware"，用于避免与其他库的指标重名
+func WithMetricsPrefix(prefix string) PrometheusOption {
+	return func(c *prometheusConfig) {
+		c.prefix = prefix
+	}
+}
+
+// WithRegisterer 把指标注册到 reg 上而不是全局 registry，对同一个 reg 多次创建时共享已注册的指标。
+// NewPrometheusMiddlewareWithBuckets 与 NewPrometheusMiddlewareWithRegistry 自带 registry，忽略该选项
+func WithRegisterer(reg prometheus.Registerer) PrometheusOption {
+	return func(c *prometheusConfig) {
+		c.registerer = reg
+	}
+}
+
+func newPrometheusConfig(opts []PrometheusOption) prometheusConfig {
+	cfg := prometheusConfig{prefix: defaultMetricsPrefix, registerer: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// promMetrics 是 Prometheus 中间件使用的一组指标
+type promMetrics struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+}
+
+func newPromMetrics(prefix string, buckets []float64) *promMetrics {
+	return &promMetrics{
+		requestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: prefix,
+				Name:      "requests_total",
+				Help:      "Total number of requests handled by middleware",
+			},
+			[]string{"client", "method"},
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: prefix,
+				Name:      "request_duration_seconds",
+				Help:      "Histogram of request processing duration",
+				Buckets:   buckets,
+			},
+			[]string{"client", "method"},
+		),
+		requestErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: prefix,
+				Name:      "request_errors_total",
+				Help:      "Total number of errors returned by handler",
+			},
+			[]string{"client", "method", "error_type"},
+		),
+	}
+}
+
+// register 把 m 的指标注册到 reg 上。同名指标已注册时复用已有的 collector，
+// 因此对同一个 registry 重复调用不会 panic
+func (m *promMetrics) register(reg prometheus.Registerer) *promMetrics {
+	return &promMetrics{
+		requestsTotal:   RegisterOrReuse(reg, m.requestsTotal),
+		requestDuration: RegisterOrReuse(reg, m.requestDuration),
+		requestErrors:   RegisterOrReuse(reg, m.requestErrors),
+	}
+}
+
+// RegisterOrReuse 把指标注册到 reg，已存在相同描述的指标时返回已注册的实例，其他注册错误直接 panic
+func RegisterOrReuse[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
 var (
-	requestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "middleware_requests_total",
-			Help: "Total number of requests handled by middleware",
-		},
-		[]string{"client", "method"},
-	)
-
-	requestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "middleware_request_duration_seconds",
-			Help:    "Histogram of request processing duration",
-			Buckets: []float64{0.1, 0.2, 0.5, 1.0, 5.0},
-		},
-		[]string{"client", "method"},
-	)
-
-	requestErrors = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "middleware_request_errors_total",
-			Help: "Total number of errors returned by handler",
-		},
-		[]string{"client", "method"},
-	)
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *promMetrics
 )
 
-func init() {
-	// 注册指标
-	prometheus.MustRegister(requestsTotal, requestDuration, requestErrors)
+// getDefaultMetrics 在第一次使用时把默认指标注册到全局 registry
+func getDefaultMetrics() *promMetrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = newPromMetrics(defaultMetricsPrefix, defaultBuckets).register(prometheus.DefaultRegisterer)
+	})
+	return defaultMetrics
 }
 
 // 弃用
@@ -57,8 +140,39 @@ func GetPrometheusClientLabel(ctx context.Context, client any) (cl string, metho
 	return
 }
 
-// PrometheusMiddleware 实现
-func NewPrometheusMiddleware[T any]() Middleware[T] {
+// GetPrometheusMethodName 从 context 获取方法名（由代码生成或调用方通过 PrometheusMethodKey 注入）
+func GetPrometheusMethodName(ctx context.Context) string {
+	_, method := GetPrometheusClientLabel(ctx, nil)
+	return method
+}
+
+// PrometheusMiddleware 实现，指标默认注册在全局 registry 上，可用 WithRegisterer 修改
+func NewPrometheusMiddleware[T any](opts ...PrometheusOption) Middleware[T] {
+	cfg := newPrometheusConfig(opts)
+	if cfg.prefix == defaultMetricsPrefix && cfg.registerer == prometheus.DefaultRegisterer {
+		return newPrometheusMiddleware[T](getDefaultMetrics())
+	}
+	return newPrometheusMiddleware[T](newPromMetrics(cfg.prefix, defaultBuckets).register(cfg.registerer))
+}
+
+// NewPrometheusMiddlewareWithBuckets 使用自定义耗时分桶（秒）创建 Prometheus 中间件。
+// 指标注册在返回的独立 registry 上，不会与全局 registry 中的默认指标冲突，
+// 需要由调用方暴露（如 promhttp.HandlerFor(reg, promhttp.HandlerOpts{})）
+func NewPrometheusMiddlewareWithBuckets[T any](buckets []float64, opts ...PrometheusOption) (Middleware[T], *prometheus.Registry) {
+	cfg := newPrometheusConfig(opts)
+	reg := prometheus.NewRegistry()
+	return newPrometheusMiddleware[T](newPromMetrics(cfg.prefix, buckets).register(reg)), reg
+}
+
+// NewPrometheusMiddlewareWithRegistry 创建把指标注册到 reg 上的 Prometheus 中间件，
+// 用于在同一进程中隔离多个池的指标，或避免测试污染全局 registry。
+// 对同一个 reg 多次调用时共享已注册的指标
+func NewPrometheusMiddlewareWithRegistry[T any](reg prometheus.Registerer, opts ...PrometheusOption) Middleware[T] {
+	cfg := newPrometheusConfig(opts)
+	return newPrometheusMiddleware[T](newPromMetrics(cfg.prefix, defaultBuckets).register(reg))
+}
+
+func newPrometheusMiddleware[T any](metrics *promMetrics) Middleware[T] {
 	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
 		var labels []string
 		cl, method := GetPrometheusClientLabel(ctx, client)
@@ -67,15 +181,15 @@ func NewPrometheusMiddleware[T any]() Middleware[T] {
 		}
 		labels = append(labels, cl, method)
 		start := time.Now()
-		requestsTotal.WithLabelValues(labels...).Inc()
+		metrics.requestsTotal.WithLabelValues(labels...).Inc()
 
 		err := next(ctx, client)
 
 		duration := time.Since(start).Seconds()
-		requestDuration.WithLabelValues(labels...).Observe(duration)
+		metrics.requestDuration.WithLabelValues(labels...).Observe(duration)
 
 		if err != nil {
-			requestErrors.WithLabelValues(labels...).Inc()
+			metrics.requestErrors.WithLabelValues(cl, method, ClassifyError(err)).Inc()
 		}
 		return err
 	})
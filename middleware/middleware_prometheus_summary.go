@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// summaryMetricsPrefix 是摘要指标名的默认前缀，与直方图中间件的 "middleware" 不同
+const summaryMetricsPrefix = "clientpool"
+
+// defaultObjectives 是摘要的默认分位数及其允许误差
+var defaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// NewPrometheusSummaryMiddleware 用 Summary 记录请求耗时（秒）的分位数，指标为
+// <prefix>_request_latency_summary{client,method}（默认 clientpool_request_latency_summary），
+// 前缀与 registry 分别由 WithMetricsPrefix 与 WithRegisterer 设置，默认注册在全局 registry 上。
+// 与直方图不同，分位数在客户端精确计算，不受分桶粒度影响，但不能跨实例聚合。
+// objectives 为分位数到允许误差的映射，为空时使用 p50/p90/p99。
+// 指标在同一个 registry 上只在第一次创建时注册，之后再创建复用已注册的指标，传入的 objectives 不再生效
+func NewPrometheusSummaryMiddleware[T any](objectives map[float64]float64, opts ...PrometheusOption) Middleware[T] {
+	cfg := newPrometheusConfig(append([]PrometheusOption{WithMetricsPrefix(summaryMetricsPrefix)}, opts...))
+	if len(objectives) == 0 {
+		objectives = defaultObjectives
+	}
+	latency := RegisterOrReuse(cfg.registerer, prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:  cfg.prefix,
+			Name:       "request_latency_summary",
+			Help:       "Summary of request processing duration in seconds",
+			Objectives: objectives,
+		},
+		[]string{"client", "method"},
+	))
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		start := time.Now()
+		err := next(ctx, client)
+		latency.WithLabelValues(client.GetClientId(), GetPrometheusMethodName(ctx)).Observe(time.Since(start).Seconds())
+		return err
+	})
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestPrometheusMiddlewareWithBuckets(t *testing.T) {
+	buckets := []float64{0.001, 0.01, 0.1}
+	m, reg := NewPrometheusMiddlewareWithBuckets[string](buckets)
+	// 与全局默认指标同名，但注册在独立 registry 上，不应 panic
+	_ = NewPrometheusMiddleware[string]()
+
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errors.New("upstream error")
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, mf := range families {
+		if mf.GetName() != "middleware_request_duration_seconds" {
+			continue
+		}
+		found = true
+		h := mf.GetMetric()[0].GetHistogram()
+		if len(h.GetBucket()) != len(buckets) {
+			t.Fatalf("expected %d buckets, got %d", len(buckets), len(h.GetBucket()))
+		}
+		for i, b := range h.GetBucket() {
+			if b.GetUpperBound() != buckets[i] {
+				t.Fatalf("bucket %d: expected %v, got %v", i, buckets[i], b.GetUpperBound())
+			}
+		}
+		if h.GetSampleCount() != 2 {
+			t.Fatalf("expected 2 observations, got %d", h.GetSampleCount())
+		}
+	}
+	if !found {
+		t.Fatal("duration histogram not registered")
+	}
+	if v := counterValue(t, reg, "middleware_request_errors_total"); v != 1 {
+		t.Fatalf("expected 1 error, got %v", v)
+	}
+}
+
+func TestPrometheusMiddlewareWithRegistry(t *testing.T) {
+	regA, regB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	a := NewPrometheusMiddlewareWithRegistry[string](regA)
+	b := NewPrometheusMiddlewareWithRegistry[string](regB)
+
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	ok := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+	_ = a.Execute(context.Background(), client, ok)
+	_ = a.Execute(context.Background(), client, ok)
+	_ = b.Execute(context.Background(), client, ok)
+
+	if v := counterValue(t, regA, "middleware_requests_total"); v != 2 {
+		t.Fatalf("registry A: expected 2 requests, got %v", v)
+	}
+	if v := counterValue(t, regB, "middleware_requests_total"); v != 1 {
+		t.Fatalf("registry B: expected 1 request, got %v", v)
+	}
+}
+
+// counterValue 返回 registry 中名为 name 的计数器第一条序列的值
+func counterValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("%s not registered", name)
+	return 0
+}
+
+func TestPrometheusMiddlewareRegisterTwice(t *testing.T) {
+	// 默认构造函数多次调用共享全局指标
+	_ = NewPrometheusMiddleware[string]()
+	_ = NewPrometheusMiddleware[int]()
+
+	reg := prometheus.NewRegistry()
+	a := NewPrometheusMiddlewareWithRegistry[string](reg)
+	b := NewPrometheusMiddlewareWithRegistry[string](reg)
+
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	ok := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+	_ = a.Execute(context.Background(), client, ok)
+	_ = b.Execute(context.Background(), client, ok)
+
+	if v := counterValue(t, reg, "middleware_requests_total"); v != 2 {
+		t.Fatalf("expected shared counter with 2 requests, got %v", v)
+	}
+}
+
+func TestPrometheusMiddlewareErrorType(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewPrometheusMiddlewareWithRegistry[string](reg)
+	client := cw.NewClientWrapper("client", "client-1", 1)
+
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return fmt.Errorf("call: %w", context.DeadlineExceeded)
+	})
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errors.New("upstream error")
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "middleware_request_errors_total" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "error_type" {
+					got[l.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if got[ErrorTypeTimeout] != 1 || got[ErrorTypeOther] != 1 || len(got) != 2 {
+		t.Fatalf("unexpected error_type counts: %v", got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	errCustom := errors.New("custom")
+	RegisterErrorClassifier(func(err error) string {
+		if errors.Is(err, errCustom) {
+			return "custom"
+		}
+		return ""
+	})
+
+	cases := map[error]string{
+		context.Canceled: ErrorTypeCanceled,
+		NewMiddlewareError("bulkhead", ErrBulkheadFull):         ErrorTypeMiddleware,
+		NewMiddlewareError("timeout", context.DeadlineExceeded): ErrorTypeTimeout,
+		fmt.Errorf("wrapped: %w", errCustom):                    "custom",
+		errors.New("unknown"):                                   ErrorTypeOther,
+	}
+	for err, want := range cases {
+		if got := ClassifyError(err); got != want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+func TestPrometheusMiddlewareMetricsPrefix(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewPrometheusMiddlewareWithRegistry[string](reg, WithMetricsPrefix("myapp_clientpool"))
+	client := cw.NewClientWrapper("client", "client-1", 1)
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errors.New("upstream error")
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, mf := range families {
+		names[mf.GetName()] = true
+	}
+	for _, name := range []string{"myapp_clientpool_requests_total", "myapp_clientpool_request_duration_seconds", "myapp_clientpool_request_errors_total"} {
+		if !names[name] {
+			t.Fatalf("expected metric %s, got %v", name, names)
+		}
+	}
+	if names["middleware_requests_total"] {
+		t.Fatal("default prefix should not be used")
+	}
+}
+
+func TestPrometheusSummaryMiddleware(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	opts := []PrometheusOption{WithRegisterer(reg), WithMetricsPrefix("myapp")}
+	m := NewPrometheusSummaryMiddleware[string](map[float64]float64{0.5: 0.05, 0.99: 0.001}, opts...)
+	// 重复创建复用已注册的指标，不会 panic
+	_ = NewPrometheusSummaryMiddleware[string](nil, opts...)
+	_ = NewPrometheusSummaryMiddleware[string](nil)
+	client := cw.NewClientWrapper("client", "summary-client", 1)
+	ctx := context.WithValue(context.Background(), PrometheusMethodKey{}, "get_slot")
+
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond} {
+		if err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			time.Sleep(d)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "myapp_request_latency_summary" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["client"] != "summary-client" || labels["method"] != "get_slot" {
+				continue
+			}
+			s := metric.GetSummary()
+			if s.GetSampleCount() != 3 || s.GetSampleSum() < 0.006 {
+				t.Fatalf("expected 3 observations of at least 6ms in total, got %d / %v", s.GetSampleCount(), s.GetSampleSum())
+			}
+			if len(s.GetQuantile()) != 2 {
+				t.Fatalf("expected the configured quantiles, got %v", s.GetQuantile())
+			}
+			return
+		}
+	}
+	t.Fatal("summary metric not found")
+}
+
+func TestPrometheusSummaryMiddlewareDefaultName(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewPrometheusSummaryMiddleware[string](nil, WithRegisterer(reg))
+	client := cw.NewClientWrapper("client", "summary-client", 1)
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "clientpool_request_latency_summary" {
+		t.Fatalf("expected clientpool_request_latency_summary, got %v", families)
+	}
+}
@@ -34,3 +34,80 @@ func (r *RateLimiterMiddleware[T]) Execute(ctx context.Context, client cw.Client
 	}
 	return next(ctx, client)
 }
+
+// PerClientRateLimiterMiddleware 按客户端ID分别限流，每个客户端的限流器在第一次请求时创建
+type PerClientRateLimiterMiddleware[T any] struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	limit    rate.Limit
+	burst    int
+	timeOut  time.Duration
+}
+
+// NewPerClientRateLimiterMiddleware 让每个客户端各自拥有速率为 r、突发为 b 的令牌桶，
+// 适合各上游有独立配额的场景。等待令牌超过 timeOut 时返回中间件错误，timeOut <= 0 时只受 ctx 控制。
+// 与 NewPerClientBulkheadMiddleware 相同，已移除客户端的限流器不会被清理
+func NewPerClientRateLimiterMiddleware[T any](r rate.Limit, b int, timeOut time.Duration) Middleware[T] {
+	return &PerClientRateLimiterMiddleware[T]{
+		limiters: make(map[string]*rate.Limiter),
+		limit:    r,
+		burst:    b,
+		timeOut:  timeOut,
+	}
+}
+
+func (r *PerClientRateLimiterMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	waitCtx := ctx
+	if r.timeOut > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, r.timeOut)
+		defer cancel()
+	}
+	if err := r.limiter(client.GetClientId()).Wait(waitCtx); err != nil {
+		return NewMiddlewareError("per-client rate limiter", err)
+	}
+	return next(ctx, client)
+}
+
+// limiter 返回客户端对应的限流器，不存在时创建
+func (r *PerClientRateLimiterMiddleware[T]) limiter(id string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.limiters[id]
+	if !ok {
+		l = rate.NewLimiter(r.limit, r.burst)
+		r.limiters[id] = l
+	}
+	return l
+}
+
+// DefaultMethodLimit 是 NewPerMethodRateLimiterMiddleware 中默认限流配置的 key
+const DefaultMethodLimit = "*"
+
+type PerMethodRateLimiterMiddleware[T any] struct {
+	limiters map[string]*rate.Limiter
+}
+
+// NewPerMethodRateLimiterMiddleware 按方法名（GetPrometheusMethodName）分别限流。
+// limits 中没有配置的方法使用 DefaultMethodLimit 对应的限流器，未配置默认值时不限流。
+// 等待令牌只受 ctx 控制
+func NewPerMethodRateLimiterMiddleware[T any](limits map[string]rate.Limit, burst int) Middleware[T] {
+	limiters := make(map[string]*rate.Limiter, len(limits))
+	for method, limit := range limits {
+		limiters[method] = rate.NewLimiter(limit, burst)
+	}
+	return &PerMethodRateLimiterMiddleware[T]{limiters: limiters}
+}
+
+func (r *PerMethodRateLimiterMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	limiter, ok := r.limiters[GetPrometheusMethodName(ctx)]
+	if !ok {
+		limiter, ok = r.limiters[DefaultMethodLimit]
+	}
+	if ok {
+		if err := limiter.Wait(ctx); err != nil {
+			return NewMiddlewareError("per-method rate limiter", err)
+		}
+	}
+	return next(ctx, client)
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"golang.org/x/time/rate"
+)
+
+func TestPerMethodRateLimiterMiddleware(t *testing.T) {
+	m := NewPerMethodRateLimiterMiddleware[string](map[string]rate.Limit{
+		"fast":             rate.Inf,
+		DefaultMethodLimit: rate.Every(time.Hour),
+	}, 1)
+	client := cw.NewClientWrapper("client", "client", 1)
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+
+	fast := context.WithValue(context.Background(), PrometheusMethodKey{}, "fast")
+	for i := 0; i < 10; i++ {
+		if err := m.Execute(fast, client, next); err != nil {
+			t.Fatalf("fast method should not be limited: %v", err)
+		}
+	}
+
+	// 未配置的方法使用默认限流器：突发 1 个后需要等待一小时
+	slow := context.WithValue(context.Background(), PrometheusMethodKey{}, "slow")
+	if err := m.Execute(slow, client, next); err != nil {
+		t.Fatalf("first request should pass: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(slow, 20*time.Millisecond)
+	defer cancel()
+	err := m.Execute(ctx, client, next)
+	if err == nil || !IsMiddlewareError(err) {
+		t.Fatalf("expected rate limit middleware error, got %v", err)
+	}
+}
+
+func TestPerClientRateLimiterMiddleware(t *testing.T) {
+	m := NewPerClientRateLimiterMiddleware[string](rate.Every(time.Hour), 1, 20*time.Millisecond)
+	a := cw.NewClientWrapper("a", "a", 1)
+	b := cw.NewClientWrapper("b", "b", 1)
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil }
+
+	// 每个客户端各有 1 个突发令牌，a 用完不影响 b
+	if err := m.Execute(context.Background(), a, next); err != nil {
+		t.Fatalf("first request on a should pass: %v", err)
+	}
+	if err := m.Execute(context.Background(), b, next); err != nil {
+		t.Fatalf("first request on b should pass: %v", err)
+	}
+	for _, client := range []cw.ClientWrapped[string]{a, b} {
+		if err := m.Execute(context.Background(), client, next); err == nil || !IsMiddlewareError(err) {
+			t.Fatalf("expected %s to be throttled, got %v", client.GetClientId(), err)
+		}
+	}
+}
+
+// context.WithTimeout 不会延长调用方的截止时间，rate.Limiter.Wait 在截止时间不够时立即返回，
+// 该测试防止之后的修改破坏这一点
+func TestRateLimiterMiddleware_CallerDeadline(t *testing.T) {
+	// 每 500ms 一个令牌，timeOut 远大于调用方的截止时间
+	m := NewRateLimiterMiddleware[string](2, 1, time.Second)
+	client := cw.NewClientWrapper("client", "client", 1)
+	called := false
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		called = true
+		return nil
+	}
+
+	if err := m.Execute(context.Background(), client, next); err != nil {
+		t.Fatalf("first request should pass: %v", err)
+	}
+	called = false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := m.Execute(ctx, client, next)
+	if err == nil || !IsMiddlewareError(err) {
+		t.Fatalf("expected rate limit middleware error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected caller deadline to be honored, waited %v", elapsed)
+	}
+	if called {
+		t.Fatalf("next should not be called when throttled")
+	}
+
+	// 调用方已经超时时立即返回 ctx 的错误
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	err = m.Execute(expired, client, next)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded for expired context, got %v", err)
+	}
+}
@@ -3,16 +3,129 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
 
 	cw "github.com/bighu630/clientPool/clientWrapper"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// defaultMaxStack 是记录 panic 堆栈的默认最大字节数
+const defaultMaxStack = 4096
+
+// RecoverOption 配置 recover 中间件
+type RecoverOption func(*recoverConfig)
+
+type recoverConfig struct {
+	panics   *prometheus.CounterVec // panic 计数器，nil 表示不记录
+	stack    bool                   // 是否把堆栈附加到返回的错误中
+	maxStack int                    // 堆栈截断长度
+	logger   *slog.Logger           // 记录 panic 与堆栈的 logger，nil 表示不记录
+	handler  PanicHandler           // 决定 panic 的最终结果，nil 表示转换为错误
+}
+
+// PanicHandler 处理恢复的 panic：返回值作为本次请求的错误（返回 nil 视为成功），
+// 也可以再次 panic 让 panic 继续向上传播（如开发环境快速失败）
+type PanicHandler func(ctx context.Context, clientID string, r any) error
+
+// WithStackTrace 把 panic 时的堆栈附加到返回的错误中，超过 maxBytes 的部分被截断，
+// maxBytes 小于等于 0 时使用默认值 4096
+func WithStackTrace(maxBytes int) RecoverOption {
+	return func(c *recoverConfig) {
+		c.stack = true
+		if maxBytes > 0 {
+			c.maxStack = maxBytes
+		}
+	}
+}
+
+// WithPanicLogger 以 Error 级别记录恢复的 panic 及其堆栈（按 WithStackTrace 的长度截断）
+func WithPanicLogger(logger *slog.Logger) RecoverOption {
+	return func(c *recoverConfig) {
+		c.logger = logger
+	}
+}
+
+// WithPanicHandler 在记录指标与日志之后调用 handler 决定 panic 的结果，
+// 未设置时 panic 被转换为 "panic recovered" 错误
+func WithPanicHandler(handler PanicHandler) RecoverOption {
+	return func(c *recoverConfig) {
+		c.handler = handler
+	}
+}
+
+// WithPanicMetrics 把恢复的 panic 计入 clientpool_panics_total{client}
+func WithPanicMetrics() RecoverOption {
+	return func(c *recoverConfig) {
+		c.panics = getPanicsTotal()
+	}
+}
+
 func RecoverMiddleware[T any]() Middleware[T] {
+	return NewRecoverMiddleware[T]()
+}
+
+// RecoverMiddlewareWithMetrics 与 RecoverMiddleware 相同，同时把恢复的 panic 计入
+// clientpool_panics_total{client}，便于单独对 panic 频率告警
+func RecoverMiddlewareWithMetrics[T any]() Middleware[T] {
+	return NewRecoverMiddleware[T](WithPanicMetrics())
+}
+
+var (
+	panicsTotalOnce sync.Once
+	panicsTotal     *prometheus.CounterVec
+)
+
+// getPanicsTotal 在第一次使用时把 panic 计数器注册到全局 registry
+func getPanicsTotal() *prometheus.CounterVec {
+	panicsTotalOnce.Do(func() {
+		panicsTotal = RegisterOrReuse(prometheus.DefaultRegisterer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "clientpool_panics_total",
+				Help: "Total number of panics recovered by middleware",
+			},
+			[]string{"client"},
+		))
+	})
+	return panicsTotal
+}
+
+// NewRecoverMiddleware 创建把 panic 转换为错误的中间件，可选记录堆栈、日志与指标
+func NewRecoverMiddleware[T any](opts ...RecoverOption) Middleware[T] {
+	cfg := recoverConfig{maxStack: defaultMaxStack}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) (err error) {
 		// 捕获 panic
 		defer func() {
-			if r := recover(); r != nil {
-				err = fmt.Errorf("panic recovered: %v", r)
+			r := recover()
+			if r == nil {
+				return
+			}
+			err = fmt.Errorf("panic recovered: %v", r)
+			if cfg.panics != nil {
+				cfg.panics.WithLabelValues(client.GetClientId()).Inc()
+			}
+			if cfg.stack || cfg.logger != nil {
+				stack := debug.Stack()
+				if len(stack) > cfg.maxStack {
+					stack = append(stack[:cfg.maxStack:cfg.maxStack], "\n...(truncated)"...)
+				}
+				if cfg.stack {
+					err = fmt.Errorf("panic recovered: %v\n%s", r, stack)
+				}
+				if cfg.logger != nil {
+					cfg.logger.LogAttrs(ctx, slog.LevelError, "client pool panic recovered",
+						slog.String("client", client.GetClientId()),
+						slog.Any("panic", r),
+						slog.String("stack", string(stack)),
+					)
+				}
+			}
+			if cfg.handler != nil {
+				err = cfg.handler(ctx, client.GetClientId(), r)
 			}
 		}()
 
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecoverMiddlewareWithMetrics(t *testing.T) {
+	m := RecoverMiddlewareWithMetrics[string]()
+	client := cw.NewClientWrapper("client", "panicky", 1)
+	counter := getPanicsTotal().WithLabelValues("panicky")
+	before := testutil.ToFloat64(counter)
+
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("expected panic to be converted to an error")
+	}
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error { return nil })
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("expected panic counter to increase by 1, got %v", got)
+	}
+}
+
+func TestRecoverMiddlewareStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	m := NewRecoverMiddleware[string](WithStackTrace(0), WithPanicLogger(logger))
+	client := cw.NewClientWrapper("client", "client-1", 1)
+
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	const frame = "TestRecoverMiddlewareStackTrace"
+	if err == nil || !strings.Contains(err.Error(), "panic recovered: boom") || !strings.Contains(err.Error(), frame) {
+		t.Fatalf("expected error with stack trace, got %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "client=client-1") || !strings.Contains(out, frame) {
+		t.Fatalf("expected logged stack trace, got %s", out)
+	}
+
+	// 超长堆栈被截断
+	short := NewRecoverMiddleware[string](WithStackTrace(64))
+	err = short.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	if !strings.HasSuffix(err.Error(), "...(truncated)") || len(err.Error()) > 200 {
+		t.Fatalf("expected truncated stack, got %q", err)
+	}
+
+	// 默认不附加堆栈
+	err = RecoverMiddleware[string]().Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	if err == nil || err.Error() != "panic recovered: boom" {
+		t.Fatalf("expected plain error, got %v", err)
+	}
+}
+
+// panicError 是测试中自定义 panic 处理函数返回的错误类型
+type panicError struct {
+	clientID string
+	value    any
+}
+
+func (e *panicError) Error() string { return "panic on " + e.clientID }
+
+func TestRecoverMiddlewarePanicHandler(t *testing.T) {
+	m := NewRecoverMiddleware[string](WithPanicHandler(func(ctx context.Context, clientID string, r any) error {
+		return &panicError{clientID: clientID, value: r}
+	}))
+	client := cw.NewClientWrapper("client", "client-1", 1)
+
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	var pe *panicError
+	if !errors.As(err, &pe) || pe.clientID != "client-1" || pe.value != "boom" {
+		t.Fatalf("expected typed error from the handler, got %v", err)
+	}
+
+	// 处理函数可以让 panic 继续传播
+	rethrow := NewRecoverMiddleware[string](WithPanicHandler(func(ctx context.Context, clientID string, r any) error {
+		panic(r)
+	}))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected panic to propagate, got %v", r)
+		}
+	}()
+	_ = rethrow.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		panic("boom")
+	})
+	t.Fatal("expected Execute to panic")
+}
@@ -8,8 +8,65 @@ import (
 	cw "github.com/bighu630/clientPool/clientWrapper"
 )
 
+// NewRetryMiddleware 使用默认配置重试：最多 6 次，间隔 200ms
 func NewRetryMiddleware[T any]() Middleware[T] {
+	return NewRetryMiddlewareWithConfig[T](6, 200*time.Millisecond)
+}
+
+// NewRetryMiddlewareWithConfig 按 attempts 与 delay 重试，opts 可进一步调整退避策略、
+// 最大间隔（retry.MaxDelay）、重试条件（retry.RetryIf）等，后传入的选项覆盖默认值。
+// 每次失败的尝试在下一次尝试开始时通知 context 中的尝试观察者（见 WithAttemptObserver），
+// 内层中间件与业务函数可以通过 AttemptFromContext 读取当前是第几次尝试。
+// attempts 小于 1 时按 1 处理（只尝试一次，不重试）；retry-go 中 0 表示无限重试，这里不支持
+func NewRetryMiddlewareWithConfig[T any](attempts int, delay time.Duration, opts ...retry.Option) Middleware[T] {
+	attempts = max(attempts, 1)
 	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
-		return retry.Do(func() error { return next(ctx, client) }, retry.LastErrorOnly(true), retry.Delay(200*time.Millisecond), retry.Attempts(6))
+		options := append([]retry.Option{
+			retry.Context(ctx), // 请求取消后不再重试
+			retry.LastErrorOnly(true),
+			retry.Delay(delay),
+			retry.Attempts(uint(attempts)),
+		}, opts...)
+		var lastErr error
+		attempt := 0
+		return retry.Do(func() error {
+			// 只有真正发生重试时才通知上一次的失败，最后一次尝试的结果留给调用方
+			if lastErr != nil {
+				observeAttempt(ctx, lastErr)
+			}
+			attempt++
+			lastErr = next(context.WithValue(ctx, attemptKey{}, attempt), client)
+			return lastErr
+		}, options...)
 	})
 }
+
+// RetryIf 返回重试条件选项：fn 返回 false 的错误视为永久错误，立即停止重试并返回该错误，
+// 避免对参数错误等不可恢复的错误反复重试
+func RetryIf(fn func(err error) bool) retry.Option {
+	return retry.RetryIf(fn)
+}
+
+type attemptKey struct{}
+
+// AttemptFromContext 返回重试中间件设置的尝试序号，第一次尝试为 1；不在重试中间件内时返回 0。
+// 嵌套多个重试中间件时返回最内层的序号
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+type attemptObserverKey struct{}
+
+// WithAttemptObserver 在 context 中注入中间尝试的观察者：重试中间件每次尝试失败且即将重试时调用 fn，
+// 最后一次尝试的结果不会通知（由调用方自行处理）
+func WithAttemptObserver(ctx context.Context, fn func(err error)) context.Context {
+	return context.WithValue(ctx, attemptObserverKey{}, fn)
+}
+
+// observeAttempt 通知 context 中的尝试观察者
+func observeAttempt(ctx context.Context, err error) {
+	if fn, ok := ctx.Value(attemptObserverKey{}).(func(err error)); ok {
+		fn(err)
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestRetryMiddlewareWithConfig(t *testing.T) {
+	m := NewRetryMiddlewareWithConfig[string](3, time.Millisecond)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	calls := 0
+	errUpstream := errors.New("upstream error")
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		return errUpstream
+	})
+	if !errors.Is(err, errUpstream) {
+		t.Fatalf("expected last error, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+
+	// 成功后不再重试
+	calls = 0
+	err = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		if calls < 2 {
+			return errUpstream
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("expected success on second attempt, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryMiddleware_NonPositiveAttempts(t *testing.T) {
+	client := cw.NewClientWrapper("client", "client", 1)
+	errUpstream := errors.New("upstream error")
+	for _, attempts := range []int{0, -1} {
+		m := NewRetryMiddlewareWithConfig[string](attempts, time.Millisecond)
+		// 0 在 retry-go 中表示无限重试，这里设置超时兜底，避免测试卡住
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		calls := 0
+		err := m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			calls++
+			return errUpstream
+		})
+		cancel()
+		if !errors.Is(err, errUpstream) || calls != 1 {
+			t.Fatalf("attempts=%d: expected a single attempt, got %v after %d calls", attempts, err, calls)
+		}
+	}
+}
+
+func TestRetryMiddleware_RetryIf(t *testing.T) {
+	errPermanent := errors.New("permanent error")
+	m := NewRetryMiddlewareWithConfig[string](5, time.Millisecond, RetryIf(func(err error) bool {
+		return !errors.Is(err, errPermanent)
+	}))
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	calls := 0
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		return errPermanent
+	})
+	if !errors.Is(err, errPermanent) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected exactly one call for a permanent error, got %d", calls)
+	}
+}
+
+func TestRetryMiddleware_ContextCancelled(t *testing.T) {
+	m := NewRetryMiddlewareWithConfig[string](5, 20*time.Millisecond)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_ = m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		cancel()
+		return errors.New("upstream error")
+	})
+	if calls != 1 {
+		t.Fatalf("expected retries to stop after cancellation, got %d calls", calls)
+	}
+}
+
+func TestRetryMiddleware_AttemptFromContext(t *testing.T) {
+	m := NewRetryMiddlewareWithConfig[string](3, time.Millisecond)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	var attempts []int
+	_ = m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		attempts = append(attempts, AttemptFromContext(ctx))
+		return errors.New("upstream error")
+	})
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[1] != 2 || attempts[2] != 3 {
+		t.Fatalf("expected attempts 1, 2, 3, got %v", attempts)
+	}
+	if got := AttemptFromContext(context.Background()); got != 0 {
+		t.Fatalf("expected 0 outside the retry middleware, got %d", got)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// Sampler 决定一次请求是否被观测（日志、追踪等）
+type Sampler interface {
+	Sample(ctx context.Context) bool
+}
+
+// SamplerFunc 把函数转换为 Sampler
+type SamplerFunc func(ctx context.Context) bool
+
+func (f SamplerFunc) Sample(ctx context.Context) bool {
+	return f(ctx)
+}
+
+type everyNSampler struct {
+	n       uint64
+	counter atomic.Uint64
+}
+
+// NewEveryNSampler 每 n 个请求采样 1 个，n <= 1 时全部采样
+func NewEveryNSampler(n uint64) Sampler {
+	return &everyNSampler{n: n}
+}
+
+func (s *everyNSampler) Sample(ctx context.Context) bool {
+	if s.n <= 1 {
+		return true
+	}
+	return (s.counter.Add(1)-1)%s.n == 0
+}
+
+// NewRateSampler 按概率采样，rate 取值 [0, 1]
+func NewRateSampler(rate float64) Sampler {
+	return SamplerFunc(func(ctx context.Context) bool {
+		return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+	})
+}
+
+// ForceSampleKey 在 context 中标记该请求必须被采样
+type ForceSampleKey struct{}
+
+// WithForceSample 返回强制采样的 context，用于调试或需要完整记录的请求
+func WithForceSample(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ForceSampleKey{}, true)
+}
+
+// IsForceSampled 判断 context 是否被标记为强制采样
+func IsForceSampled(ctx context.Context) bool {
+	forced, _ := ctx.Value(ForceSampleKey{}).(bool)
+	return forced
+}
+
+// ShouldSample 综合强制采样标记与采样器做出决策，sampler 为 nil 时全部采样
+func ShouldSample(ctx context.Context, sampler Sampler) bool {
+	if sampler == nil || IsForceSampled(ctx) {
+		return true
+	}
+	return sampler.Sample(ctx)
+}
+
+// NewSampledMiddleware 仅对采样命中的请求执行 m，未命中时直接调用 next。
+// 采样在请求执行前决定，因此无法按结果（如错误）补采样；需要“错误必采”的
+// 观测中间件应自行调用 ShouldSample
+func NewSampledMiddleware[T any](sampler Sampler, m Middleware[T]) Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		if ShouldSample(ctx, sampler) {
+			return m.Execute(ctx, client, next)
+		}
+		return next(ctx, client)
+	})
+}
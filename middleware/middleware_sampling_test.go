@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestEveryNSampler(t *testing.T) {
+	sampler := NewEveryNSampler(4)
+	sampled := 0
+	for i := 0; i < 100; i++ {
+		if sampler.Sample(context.Background()) {
+			sampled++
+		}
+	}
+	if sampled != 25 {
+		t.Fatalf("expected 25 sampled requests, got %d", sampled)
+	}
+}
+
+func TestSampledMiddleware(t *testing.T) {
+	observed := 0
+	inner := WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[string], next func(ctx context.Context, client cw.ClientWrapped[string]) error) error {
+		observed++
+		return next(ctx, client)
+	})
+	m := NewSampledMiddleware[string](NewEveryNSampler(10), inner)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	calls := 0
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls++
+		return nil
+	}
+	for i := 0; i < 20; i++ {
+		_ = m.Execute(context.Background(), client, next)
+	}
+	if calls != 20 || observed != 2 {
+		t.Fatalf("expected 20 calls and 2 observed, got %d calls and %d observed", calls, observed)
+	}
+
+	// 强制采样的请求总是被观测
+	forced := WithForceSample(context.Background())
+	for i := 0; i < 5; i++ {
+		_ = m.Execute(forced, client, next)
+	}
+	if observed != 7 {
+		t.Fatalf("expected forced requests to be observed, got %d observed", observed)
+	}
+}
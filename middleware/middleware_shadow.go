@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// ShadowClientID 是影子客户端的ID，影子请求的 ClientIDFromContext 与 GetClientId 都返回该值
+const ShadowClientID = "shadow"
+
+// ShadowOption 配置影子流量中间件
+type ShadowOption func(*shadowConfig)
+
+type shadowConfig struct {
+	logger *slog.Logger // 记录影子请求错误的 logger，nil 表示丢弃
+}
+
+// WithShadowLogger 以 Warn 级别记录影子请求的错误与 panic，便于对比新旧上游
+func WithShadowLogger(logger *slog.Logger) ShadowOption {
+	return func(c *shadowConfig) {
+		c.logger = logger
+	}
+}
+
+// ShadowMiddleware 把部分请求复制到影子客户端，见 NewShadowMiddleware
+type ShadowMiddleware[T any] struct {
+	sampler Sampler
+	shadow  cw.ClientWrapped[T]
+	logger  *slog.Logger
+	wg      sync.WaitGroup
+}
+
+// NewShadowMiddleware 把约 fraction 比例的请求复制一份发往 shadow：主请求照常执行并返回，
+// 之后在独立的 goroutine 中用 shadow 再执行一次内层中间件与业务函数，结果与错误都被丢弃。
+// 影子请求不影响主请求的延迟与熔断状态，使用去掉取消的 ctx，panic 会被恢复。
+// 业务函数会被并发调用两次，写入外部变量时需自行同步。
+// 池的 Close 不会等待影子请求，关闭影子客户端前应调用 Wait
+func NewShadowMiddleware[T any](fraction float64, shadow T, opts ...ShadowOption) *ShadowMiddleware[T] {
+	var cfg shadowConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &ShadowMiddleware[T]{
+		sampler: NewRateSampler(fraction),
+		shadow:  cw.NewClientWrapper(shadow, ShadowClientID, 1),
+		logger:  cfg.logger,
+	}
+}
+
+func (m *ShadowMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	err := next(ctx, client)
+	if m.sampler.Sample(ctx) {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			runShadow(WithClientID(context.WithoutCancel(ctx), ShadowClientID), m.shadow, next, m.logger)
+		}()
+	}
+	return err
+}
+
+// Wait 等待所有已发起的影子请求结束，通常在池 Close 之后调用
+func (m *ShadowMiddleware[T]) Wait() {
+	m.wg.Wait()
+}
+
+// runShadow 执行一次影子请求，只在配置了 logger 时记录错误
+func runShadow[T any](ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error, logger *slog.Logger) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shadow panic: %v", r)
+		}
+		if err != nil && logger != nil {
+			logger.LogAttrs(ctx, slog.LevelWarn, "client pool shadow request failed",
+				slog.String("method", GetPrometheusMethodName(ctx)),
+				slog.Any("error", err),
+			)
+		}
+	}()
+	err = next(ctx, client)
+}
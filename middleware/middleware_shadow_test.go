@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestShadowMiddleware(t *testing.T) {
+	const requests = 1000
+	m := NewShadowMiddleware[string](0.3, "shadow-upstream")
+	primary := cw.NewClientWrapper("primary-upstream", "primary", 1)
+
+	errPrimary := errors.New("primary error")
+	var shadowCalls, wrongID atomic.Int32
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		if client.GetClient() != "shadow-upstream" {
+			return errPrimary
+		}
+		if ClientIDFromContext(ctx) != ShadowClientID {
+			wrongID.Add(1)
+		}
+		shadowCalls.Add(1)
+		// 影子请求的错误与 panic 都不会影响主请求
+		panic("shadow upstream failed")
+	}
+
+	for i := 0; i < requests; i++ {
+		if err := m.Execute(context.Background(), primary, next); !errors.Is(err, errPrimary) {
+			t.Fatalf("expected the primary result, got %v", err)
+		}
+	}
+
+	// 影子请求是异步的，等全部结束后再断言
+	m.Wait()
+	n := shadowCalls.Load()
+	if n < 200 || n > 400 {
+		t.Fatalf("expected roughly 30%% of %d requests to be mirrored, got %d", requests, n)
+	}
+	if wrongID.Load() != 0 {
+		t.Fatalf("expected shadow requests to carry the shadow client id")
+	}
+}
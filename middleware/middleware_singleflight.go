@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleflightMiddleware 合并并发的相同请求：同一 key 同时只执行一次 next，其余调用者等待并共享结果。
+// 中间件只能看到 next 返回的 error，因此共享的是错误结果；需要共享返回值时，
+// 可以在 keyFn 对应的 context 中放入由调用方自行维护的结果容器。
+// 合并后的执行使用第一个调用者的 context 与客户端，它被取消时所有等待者都会收到取消错误
+type SingleflightMiddleware[T any] struct {
+	group singleflight.Group
+	keyFn func(ctx context.Context) string
+}
+
+// NewSingleflightMiddleware 创建请求合并中间件，keyFn 返回空字符串的请求不参与合并
+func NewSingleflightMiddleware[T any](keyFn func(ctx context.Context) string) Middleware[T] {
+	return &SingleflightMiddleware[T]{keyFn: keyFn}
+}
+
+func (m *SingleflightMiddleware[T]) Execute(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+	key := m.keyFn(ctx)
+	if key == "" {
+		return next(ctx, client)
+	}
+	_, err, _ := m.group.Do(key, func() (any, error) {
+		return nil, next(ctx, client)
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestSingleflightMiddleware(t *testing.T) {
+	const callers = 10
+	var entered sync.WaitGroup
+	entered.Add(callers)
+	m := NewSingleflightMiddleware[string](func(ctx context.Context) string {
+		entered.Done()
+		return "get:1"
+	})
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	errUpstream := errors.New("upstream error")
+	release := make(chan struct{})
+	var calls atomic.Int32
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		calls.Add(1)
+		<-release
+		return errUpstream
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.Execute(context.Background(), client, next)
+		}()
+	}
+	// 等所有调用者都进入中间件并加入合并后再放行
+	entered.Wait()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected next to run once, got %d", n)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, errUpstream) {
+			t.Fatalf("caller %d: expected shared error, got %v", i, err)
+		}
+	}
+
+	// 没有 key 的请求不参与合并
+	bypass := NewSingleflightMiddleware[string](func(ctx context.Context) string { return "" })
+	calls.Store(0)
+	for i := 0; i < 3; i++ {
+		_ = bypass.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			calls.Add(1)
+			return nil
+		})
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("expected 3 calls without a key, got %d", n)
+	}
+}
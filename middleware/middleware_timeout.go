@@ -14,3 +14,53 @@ func NewTimeoutMiddleware[T any](timeout time.Duration) Middleware[T] {
 		return next(ctx, client)
 	})
 }
+
+// NewDeadlineMiddleware 把请求的截止时间限制在 maxTimeout 以内：调用方已设置更早的截止时间时保持不变，
+// 只会缩短、不会延长调用方的截止时间
+func NewDeadlineMiddleware[T any](maxTimeout time.Duration) Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= maxTimeout {
+			return next(ctx, client)
+		}
+		ctx, cancel := context.WithTimeout(ctx, maxTimeout)
+		defer cancel()
+		return next(ctx, client)
+	})
+}
+
+// NewStrictTimeoutMiddleware 与 NewTimeoutMiddleware 相同，但不依赖 next 遵守 context：
+// next 在独立的 goroutine 中执行并与计时器竞争，超时后立即返回 context.DeadlineExceeded（计入熔断），
+// 即使 next 吞掉了取消错误或根本不检查 ctx。
+// 代价是不遵守 context 的 next 会在后台继续运行直到自行结束，期间占用的 goroutine 与资源不会被回收，
+// 对这类 next 频繁超时会导致 goroutine 堆积。next 的 panic 会在调用方的 goroutine 中重新抛出
+func NewStrictTimeoutMiddleware[T any](timeout time.Duration) Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type result struct {
+			err   error
+			panic any
+		}
+		// 带缓冲，超时返回后 goroutine 仍能写入并退出
+		done := make(chan result, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- result{panic: r}
+				}
+			}()
+			done <- result{err: next(ctx, client)}
+		}()
+
+		select {
+		case r := <-done:
+			if r.panic != nil {
+				panic(r.panic)
+			}
+			return r.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestDeadlineMiddleware(t *testing.T) {
+	m := NewDeadlineMiddleware[string](time.Second)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	var got time.Time
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		got, _ = ctx.Deadline()
+		return nil
+	}
+
+	// 调用方的截止时间更早，保持不变
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	_ = m.Execute(ctx, client, next)
+	if !got.Equal(want) {
+		t.Fatalf("expected caller deadline %v to be preserved, got %v", want, got)
+	}
+
+	// 调用方的截止时间更晚，缩短到 max
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_ = m.Execute(ctx, client, next)
+	if until := time.Until(got); until > time.Second {
+		t.Fatalf("expected deadline within 1s, got %v", until)
+	}
+
+	// 没有截止时间时设置 max
+	got = time.Time{}
+	_ = m.Execute(context.Background(), client, next)
+	if got.IsZero() || time.Until(got) > time.Second {
+		t.Fatalf("expected deadline within 1s, got %v", got)
+	}
+}
+
+func TestStrictTimeoutMiddleware(t *testing.T) {
+	m := NewStrictTimeoutMiddleware[string](20 * time.Millisecond)
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	// next 不检查 ctx 且吞掉错误，仍然按时返回超时错误
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected to return around the timeout, took %v", elapsed)
+	}
+
+	// 按时完成时返回 next 的结果
+	errUpstream := errors.New("upstream error")
+	if err := m.Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return errUpstream
+	}); !errors.Is(err, errUpstream) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+
+	// panic 在调用方重新抛出，外层的 recover 中间件可以捕获
+	err = RecoverMiddleware[string]().Execute(context.Background(), client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		return m.Execute(ctx, client, func(ctx context.Context, client cw.ClientWrapped[string]) error {
+			panic("boom")
+		})
+	})
+	if err == nil || err.Error() != "panic recovered: boom" {
+		t.Fatalf("expected panic to propagate to the caller, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+// TraceparentHeader 是 W3C Trace Context 规定的 HTTP 头名称
+const TraceparentHeader = "traceparent"
+
+type traceparentKey struct{}
+
+// WithTraceparent 把上游传入的 traceparent 放入 context，NewTraceparentMiddleware 会沿用它而不是重新生成
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceparentKey{}, traceparent)
+}
+
+// TraceparentFromContext 返回 context 中的 traceparent（version-traceid-spanid-flags），不存在时返回空字符串。
+// 下游 HTTP 客户端可以把它设置为 TraceparentHeader 头
+func TraceparentFromContext(ctx context.Context) string {
+	tp, _ := ctx.Value(traceparentKey{}).(string)
+	return tp
+}
+
+// NewTraceparentMiddleware 保证每个请求的 context 中都有合法的 W3C traceparent：
+// 已存在合法值时原样保留，否则生成新的 trace id 与 span id（flags 为 01，表示已采样）
+func NewTraceparentMiddleware[T any]() Middleware[T] {
+	return WrapMiddleware(func(ctx context.Context, client cw.ClientWrapped[T], next func(ctx context.Context, client cw.ClientWrapped[T]) error) error {
+		if !validTraceparent(TraceparentFromContext(ctx)) {
+			ctx = WithTraceparent(ctx, newTraceparent())
+		}
+		return next(ctx, client)
+	})
+}
+
+func newTraceparent() string {
+	var ids [24]byte
+	// crypto/rand.Read 不会返回错误
+	_, _ = rand.Read(ids[:])
+	return "00-" + hex.EncodeToString(ids[:16]) + "-" + hex.EncodeToString(ids[16:]) + "-01"
+}
+
+// validTraceparent 校验 version 00 的格式：00-<32 位十六进制>-<16 位十六进制>-<2 位十六进制>，
+// trace id 与 span id 不能全为 0
+func validTraceparent(tp string) bool {
+	if len(tp) != 55 || tp[:3] != "00-" || tp[35] != '-' || tp[52] != '-' {
+		return false
+	}
+	return validHexID(tp[3:35]) && validHexID(tp[36:52]) && isLowerHex(tp[53:])
+}
+
+func validHexID(s string) bool {
+	if !isLowerHex(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '0' {
+			return true
+		}
+	}
+	return false
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
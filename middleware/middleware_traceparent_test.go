@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	cw "github.com/bighu630/clientPool/clientWrapper"
+)
+
+func TestTraceparentMiddleware(t *testing.T) {
+	m := NewTraceparentMiddleware[string]()
+	client := cw.NewClientWrapper("client", "client", 1)
+
+	var got string
+	next := func(ctx context.Context, client cw.ClientWrapped[string]) error {
+		got = TraceparentFromContext(ctx)
+		return nil
+	}
+
+	if err := m.Execute(context.Background(), client, next); err != nil {
+		t.Fatal(err)
+	}
+	if !validTraceparent(got) {
+		t.Fatalf("expected a generated valid traceparent, got %q", got)
+	}
+	first := got
+	if err := m.Execute(context.Background(), client, next); err != nil {
+		t.Fatal(err)
+	}
+	if got == first {
+		t.Fatalf("expected a new traceparent per request, got %q twice", got)
+	}
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if err := m.Execute(WithTraceparent(context.Background(), incoming), client, next); err != nil {
+		t.Fatal(err)
+	}
+	if got != incoming {
+		t.Fatalf("expected existing traceparent to be preserved, got %q", got)
+	}
+
+	if err := m.Execute(WithTraceparent(context.Background(), "not-a-traceparent"), client, next); err != nil {
+		t.Fatal(err)
+	}
+	if !validTraceparent(got) {
+		t.Fatalf("expected invalid traceparent to be replaced, got %q", got)
+	}
+}
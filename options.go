@@ -0,0 +1,210 @@
+package clientPool
+
+import (
+	"time"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+	"github.com/bighu630/clientPool/middleware"
+)
+
+// Option 配置 ClientPool 的可选行为
+type Option func(*options)
+
+type options struct {
+	metrics   bool          // 是否注册并更新池级别的 Prometheus 指标
+	freshness time.Duration // 新鲜度窗口，0 表示不启用
+	failover  int           // 单次 Do 最多尝试的客户端数
+
+	retryObservation bool      // 重试中间件的中间失败是否计入熔断
+	cooldownJitter   float64   // 冷却时间的随机抖动比例，0 表示不抖动
+	backoff          backoff   // 连续熔断时冷却时间的指数退避，未设置时使用固定冷却时间
+	successThreshold int       // 半开状态下关闭熔断所需的连续成功次数
+	errorRate        errorRate // 按滑动窗口错误率熔断，未设置时只按连续失败次数熔断
+
+	balancerFunc  BalancerFunc // CustomBalancer 使用的选择函数
+	allowDegraded bool         // 所有客户端都熔断时是否仍选择最早失败的客户端
+
+	clock Clock // 熔断计时使用的时钟
+
+	seed   int64 // 随机数种子，seeded 为 false 时使用当前时间
+	seeded bool
+
+	recheck    bool // 执行 fn 前是否重新检查客户端是否已熔断
+	maxClients int  // 池中客户端数量上限，0 表示不限制
+
+	panicHandler middleware.PanicHandler // 默认 recover 中间件的 panic 处理函数
+	autoEvict    autoEvict               // 自动移除长期熔断的客户端，deadAfter 为 0 时不启用
+}
+
+// Clock 提供当前时间，见 WithClock
+type Clock = clientWrapper.Clock
+
+// errorRate 错误率熔断参数
+type errorRate struct {
+	rate        float64
+	window      time.Duration
+	minRequests int
+}
+
+// backoff 指数退避参数
+type backoff struct {
+	base   time.Duration
+	max    time.Duration
+	factor float64
+}
+
+// cooldown 返回第 trips 次连续熔断的冷却时间：base * factor^(trips-1)，不超过 max
+func (b backoff) cooldown(trips int) time.Duration {
+	d := float64(b.base)
+	for i := 1; i < trips && d < float64(b.max); i++ {
+		d *= b.factor
+	}
+	return min(time.Duration(d), b.max)
+}
+
+func defaultOptions() options {
+	return options{
+		successThreshold: 1,
+		clock:            clientWrapper.RealClock(),
+	}
+}
+
+// WithMetrics 控制是否注册并更新池级别的 Prometheus 指标（如熔断状态），默认关闭。
+// 指标注册在全局 registry 上且只按客户端ID区分，多个池开启时不应使用相同的客户端ID，
+// 否则会共享同一组序列，一个池移除客户端时也会删除另一个池的序列
+func WithMetrics(enabled bool) Option {
+	return func(o *options) {
+		o.metrics = enabled
+	}
+}
+
+// WithFreshness 让轮询与加权随机优先选择 window 内成功过的客户端，
+// 从未成功过的客户端视为不新鲜；没有新鲜客户端时退回到可用但不新鲜的客户端
+func WithFreshness(window time.Duration) Option {
+	return func(o *options) {
+		o.freshness = window
+	}
+}
+
+// WithFailover 让单次 Do 在客户端失败后换下一个可用客户端重试，最多尝试 maxAttempts 个客户端。
+// 每次失败都会标记对应客户端，全部失败时返回最后一个错误；中间件错误与请求取消不触发故障转移
+func WithFailover(maxAttempts int) Option {
+	return func(o *options) {
+		o.failover = maxAttempts
+	}
+}
+
+// WithRetryObservation 控制重试中间件内部的中间失败是否计入熔断失败次数。
+// 默认 false：一次 Do 无论内部重试多少次，最终失败只记一次失败；
+// 为 true 时每次失败的尝试都会记一次失败，熔断能反映上游实际承受的失败请求数
+func WithRetryObservation(enabled bool) Option {
+	return func(o *options) {
+		o.retryObservation = enabled
+	}
+}
+
+// WithCooldownJitter 让每次熔断的冷却时间在 cooldown 的 ±fraction 范围内随机浮动，
+// 避免同时熔断的客户端在同一时刻集中恢复。fraction 取值 [0, 1]，超出范围时截断
+func WithCooldownJitter(fraction float64) Option {
+	return func(o *options) {
+		o.cooldownJitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithBackoff 让反复熔断的客户端冷却时间指数增长：第 n 次连续熔断的冷却时间为
+// base * factor^(n-1)，最多为 limit，此时忽略池的 cooldown 参数。客户端连续成功 maxFails 次后
+// 视为恢复稳定，退避重新从 base 开始。factor 小于 1 时按 1 处理，limit 小于 base 时按 base 处理
+func WithBackoff(base, limit time.Duration, factor float64) Option {
+	return func(o *options) {
+		o.backoff = backoff{base: base, max: max(limit, base), factor: max(factor, 1)}
+	}
+}
+
+// WithSuccessThreshold 要求熔断中的客户端在半开状态下连续成功 n 次才关闭熔断，
+// 未达到前每次只放行一个探测请求，期间任一失败都会重新熔断。默认 1
+func WithSuccessThreshold(n int) Option {
+	return func(o *options) {
+		o.successThreshold = max(n, 1)
+	}
+}
+
+// WithErrorRateThreshold 在连续失败次数之外增加按错误率熔断：window 内请求数不少于 minRequests
+// 且失败比例超过 rate 时熔断，避免间歇失败的上游因连续失败计数被成功清零而永远不熔断。
+// 熔断时清空窗口，恢复后重新统计
+func WithErrorRateThreshold(rate float64, window time.Duration, minRequests int) Option {
+	return func(o *options) {
+		o.errorRate = errorRate{rate: rate, window: window, minRequests: max(minRequests, 1)}
+	}
+}
+
+// WithBalancerFunc 配置 CustomBalancer 使用的选择函数，用于内置策略无法满足的路由（如按地域）。
+// fn 在池的读锁下调用，应当快速返回且不能调用池的方法
+func WithBalancerFunc(fn BalancerFunc) Option {
+	return func(o *options) {
+		o.balancerFunc = fn
+	}
+}
+
+// WithAllowDegraded 为 true 时，所有客户端都熔断（没有可选客户端）时不再返回 NoAvailableClientError，
+// 而是选择最后一次失败最早的客户端执行请求。降级请求照常更新熔断状态：失败会重新开始冷却，
+// 成功则按 WithSuccessThreshold 关闭熔断。排空中的客户端不会被降级选择
+func WithAllowDegraded(allow bool) Option {
+	return func(o *options) {
+		o.allowDegraded = allow
+	}
+}
+
+// WithClock 替换池与客户端包装读取当前时间的时钟（失败时间、冷却判断、新鲜度与错误率窗口），
+// 默认使用 time.Now。测试中传入可手动推进的时钟即可不 sleep 地验证熔断恢复；
+// 健康检查的探测间隔与中间件的计时不受影响。nil 被忽略
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+// WithSeed 用固定种子初始化池的随机数生成器，使随机、加权随机选择与冷却抖动的序列可复现，
+// 用于测试与模拟。并发调用时各请求取到的随机数顺序仍取决于调度
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
+		o.seeded = true
+	}
+}
+
+// WithRecheckBeforeInvoke 让池在中间件链执行完、即将调用 fn 之前再检查一次选中的客户端，
+// 如果它在选中后被其他请求熔断，则不执行 fn，换一个客户端重新执行整个中间件链（不消耗故障转移次数，
+// 也不记为该客户端的失败）。检查与调用 fn 之间仍有很小的窗口，此时熔断的客户端照常执行本次请求
+func WithRecheckBeforeInvoke(enabled bool) Option {
+	return func(o *options) {
+		o.recheck = enabled
+	}
+}
+
+// WithMaxClients 限制池中的客户端数量：添加客户端会超过 n 时，先淘汰最差的客户端
+// （连续失败次数最多的，相同时选最久没有成功过的，再相同时选最早加入的）。
+// 被淘汰的客户端不会被关闭，AddClientWithEviction 会返回其ID。ReplaceClients 不受限制。n <= 0 表示不限制
+func WithMaxClients(n int) Option {
+	return func(o *options) {
+		o.maxClients = n
+	}
+}
+
+// WithPanicHandler 让构造函数默认注册的 recover 中间件在 panic 时调用 handler：
+// 返回值作为本次请求的错误，也可以再次 panic（如开发环境快速失败）。未设置时 panic 被转换为错误
+func WithPanicHandler(handler middleware.PanicHandler) Option {
+	return func(o *options) {
+		o.panicHandler = handler
+	}
+}
+
+// WithAutoEvict 启动后台任务自动移除连续熔断超过 deadAfter 的客户端（从关闭进入熔断开始计算，
+// 半开探测失败不会重新计时），每次移除后调用 onEvict（可为 nil）。检查间隔为 deadAfter/4，
+// 任务在 Close 时停止。被移除的客户端不会被关闭，进行中的请求会在它上面正常完成
+func WithAutoEvict(deadAfter time.Duration, onEvict func(id string)) Option {
+	return func(o *options) {
+		o.autoEvict = autoEvict{deadAfter: deadAfter, onEvict: onEvict}
+	}
+}
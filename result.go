@@ -0,0 +1,33 @@
+package clientPool
+
+import (
+	"context"
+	"sync"
+)
+
+// DoWithResult 与 pool.Do 相同（经过中间件链、熔断与故障转移），但 fn 直接返回类型化的结果，
+// 调用方无需通过闭包捕获返回值。成功时返回执行成功的那次调用的结果，失败时返回 R 的零值与错误。
+// 对冲等中间件并发调用 fn 时，以最后一个成功的结果为准
+func DoWithResult[T, R any](pool *ClientPool[T], ctx context.Context, fn func(ctx context.Context, client T) (R, error)) (R, error) {
+	var (
+		mu     sync.Mutex
+		result R
+	)
+	err := pool.Do(ctx, func(ctx context.Context, client T) error {
+		r, err := fn(ctx, client)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result = r
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package clientPool
+
+import (
+	"time"
+
+	"github.com/bighu630/clientPool/clientWrapper"
+)
+
+// WrapperState 是单个客户端可持久化的熔断状态，用于在进程重启后恢复
+type WrapperState struct {
+	ID          string        `json:"id"`
+	FailCount   int           `json:"fail_count"`
+	Unavailable bool          `json:"unavailable"`
+	LastFail    time.Time     `json:"last_fail"`
+	LastSuccess time.Time     `json:"last_success"`
+	Cooldown    time.Duration `json:"cooldown"` // 本次熔断的冷却时间，0 表示使用默认值
+	Trips       int           `json:"trips"`    // 连续熔断次数，用于退避
+}
+
+// ExportState 导出所有客户端的熔断状态，可序列化（如 JSON）后持久化
+func (c *ClientPool[T]) ExportState() []WrapperState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	states := make([]WrapperState, 0, len(c.clients))
+	for _, cw := range c.clients {
+		snap := cw.Snapshot()
+		states = append(states, WrapperState{
+			ID:          cw.GetClientId(),
+			FailCount:   snap.FailCount,
+			Unavailable: snap.Unavailable,
+			LastFail:    snap.LastFail,
+			LastSuccess: snap.LastSuccess,
+			Cooldown:    snap.Cooldown,
+			Trips:       snap.Trips,
+		})
+	}
+	return states
+}
+
+// ImportState 把 ExportState 导出的状态恢复到 id 相同的客户端上，池中不存在的 id 被忽略。
+// 熔断中的客户端仍按导出时的最后失败时间计算冷却，已经过了冷却时间的客户端会立即进入半开探测
+func (c *ClientPool[T]) ImportState(states []WrapperState) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range states {
+		i := c.indexOfLocked(s.ID)
+		if i < 0 {
+			continue
+		}
+		cw := c.clients[i]
+		cw.Restore(clientWrapper.Snapshot{
+			FailCount:   s.FailCount,
+			LastFail:    s.LastFail,
+			LastSuccess: s.LastSuccess,
+			Unavailable: s.Unavailable,
+			Cooldown:    s.Cooldown,
+			Trips:       s.Trips,
+			Draining:    cw.IsDraining(),
+		})
+		c.observeState(cw)
+	}
+}
@@ -0,0 +1,40 @@
+package clientPool
+
+import "time"
+
+// ClientStat 是单个客户端在某一时刻的状态
+type ClientStat struct {
+	ID          string
+	Weight      int
+	FailCount   int
+	Unavailable bool   // 是否仍不可用：冷却已结束（下次被选中时放行探测）的熔断客户端视为可用
+	State       string // 状态字符串，见 clientWrapper.StateClosed 等，排空中为 draining
+	Draining    bool   // 是否正在排空，与熔断状态相互独立
+	Inflight    int    // 正在执行的请求数
+	LastFail    time.Time
+	LastSuccess time.Time
+}
+
+// Stats 返回池中所有客户端状态的时间点拷贝，修改返回值不会影响池。
+// Unavailable 按失败时间与冷却时间计算，即使冷却结束后客户端一直没有被选中也会报告为可用；
+// State 仍是熔断器本身的状态，直到下一次选择触发探测才会变化
+func (c *ClientPool[T]) Stats() []ClientStat {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats := make([]ClientStat, 0, len(c.clients))
+	for _, cw := range c.clients {
+		snap := cw.Snapshot()
+		stats = append(stats, ClientStat{
+			ID:          cw.GetClientId(),
+			Weight:      cw.GetWight(),
+			FailCount:   snap.FailCount,
+			Unavailable: snap.Unavailable && !c.cooledDown(cw, snap),
+			State:       snap.State,
+			Draining:    snap.Draining,
+			Inflight:    cw.Inflight(),
+			LastFail:    snap.LastFail,
+			LastSuccess: snap.LastSuccess,
+		})
+	}
+	return stats
+}